@@ -3,31 +3,99 @@ package comfylite3
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-
-	"github.com/davidroman0O/retrypool"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 // Callback provided by a developer to be executed when the scheduler is ready for it
 type SqlFn func(db *sql.DB) (interface{}, error)
 
+// Callback receiving the context of the job, done when the job is cancelled or times out.
+type SqlContextFn func(ctx context.Context, db *sql.DB) (interface{}, error)
+
+// ErrJobTimeout is delivered on the ticket of a job running longer than its timeout.
+var ErrJobTimeout = fmt.Errorf("job timed out: %w", context.DeadlineExceeded)
+
 type workItem struct {
-	id     uint64
-	fn     SqlFn
-	result chan interface{}
+	id       uint64
+	fn       SqlContextFn
+	ctx      context.Context // context of NewContext, nil otherwise
+	timeout  time.Duration   // deadline of the job once running, none if zero
+	done     chan struct{}
+	state    atomic.Int32
+	stop     func() bool // stops watching the context of NewContext
+	priority int         // higher runs first, see NewWithPriority
+	read     bool        // runs on the readers pool of NewRead
+	query    string      // SQL of the jobs of the OpenDB driver, for WithLogger
+	args     int
+	slot     bool        // holds a place in the queue of WithMaxQueue
+	group    bool        // a write WithGroupCommit can coalesce with the next ones
+	batch    *groupBatch // group it runs in, released after the group commits
+	queuedAt time.Time   // dispatched to the worker or the readers, for Metrics
+
+	// what the SqlFn returned, set before done is closed
+	value interface{}
+	err   error
+}
+
+const (
+	workPending int32 = iota
+	workRunning
+	workDone
+)
+
+// Claim the work for the worker, false if it was cancelled meanwhile.
+func (w *workItem) start() bool {
+	return w.state.CompareAndSwap(workPending, workRunning)
+}
+
+// Drop the work if the worker didn't pick it up yet.
+func (w *workItem) cancel(err error) bool {
+	return w.finish(workPending, nil, err)
+}
+
+// Store the outcome of the work and release whoever waits for it, only once and only from the expected state.
+func (w *workItem) finish(from int32, value interface{}, err error) bool {
+	if !w.state.CompareAndSwap(from, workDone) {
+		return false
+	}
+	w.value = value
+	w.err = err
+	close(w.done)
+	return true
+}
+
+// The outcome as delivered by WaitFor and WaitForChn: the error if any, the value otherwise.
+func (w *workItem) outcome() interface{} {
+	if w.err != nil {
+		return w.err
+	}
+	return w.value
 }
 
 // Default Memory Connection
-const memoryConn = "file::memory:?_mutex=full&cache=shared&_timeout=5000"
+const memoryConn = "file::memory:?cache=shared"
+
+// Named Memory Connection, shared with the other connections of the process
+const sharedMemoryConn = "file:%s?mode=memory&cache=shared"
 
-// Default File Connection
-const fileConn = "file:%s?cache=shared&mode=rwc&_journal_mode=WAL&_timeout=5000"
+// Default File Connection, in WAL mode
+const fileConn = "file:%s?cache=shared&mode=rwc"
+
+// Busy timeout of the connections comfylite3 opens, added to their connection string by withPragmas.
+const busyTimeoutPragma = "busy_timeout=5000"
 
 type onPanic func(v interface{}, stackTrace string)
 
@@ -55,15 +123,108 @@ type ComfyDB struct {
 	results sync.Map
 
 	migrations         []Migration
+	migrationsMu       sync.Mutex
 	migrationTableName string
 
-	memory bool
-	driver string
-	path   string
-	conn   string
-
-	pool        *retrypool.Pool[*workItem]
-	poolOptions []retrypool.Option[*workItem]
+	memory       bool
+	sharedMemory string
+	keepAlive    *sql.DB   // holds a named in-memory database alive
+	keepConn     *sql.Conn // the connection doing it
+	driver       string
+	path         string
+	createDir    bool
+	dirPerm      os.FileMode
+	conn         string
+	dsn          string     // of WithDSN, used as is
+	stmts        *stmtCache // of WithStmtCache, nil without
+
+	queue        *jobQueue
+	stopped      chan struct{} // closed when the worker returns
+	panicHandler onPanic
+	busyRetries  int
+	busyTimeout  *time.Duration // of WithBusyTimeout, the DSN's otherwise
+	busyBackoff  time.Duration
+
+	echo          io.Writer
+	echoMu        sync.Mutex
+	logger        func(QueryEvent)
+	slogger       *slog.Logger // of WithSlog
+	hooks         []jobHook
+	tracer        Tracer                    // of WithTracing
+	redact        func(query string) string // of WithTracing
+	slowThreshold time.Duration
+	onSlow        func(SlowQuery) // of WithSlowQueryThreshold
+
+	connectHooks   []connectHook
+	connectHooksMu sync.RWMutex // RegisterFunc adds hooks while readers may connect
+	journalMode    string
+	encryptionKey  atomic.Pointer[string] // of WithEncryptionKey, swapped by Rekey while readers connect
+	synchronous    string
+	cacheSize      *int   // of WithCacheSize
+	tempStore      string // of WithTempStore
+	mmapSize       *int64 // of WithMmapSize
+	readOnly       bool
+	autoVacuum     string
+	openTxs        atomic.Int32 // transactions of OpenDB in progress
+
+	slots    chan struct{}       // places in the queue of WithMaxQueue, nil when unbounded
+	onReject func(workID uint64) // WithRejectWhenFull
+	reject   bool
+
+	workerConn  atomic.Pointer[rawConn] // connection of the worker, for Interrupt
+	interruptMu sync.Mutex
+	interruptID uint64 // job Interrupt would abort
+
+	watchdog time.Duration
+	onHang   func(HangReport)
+	running  atomic.Pointer[runningJob] // job of the worker, for the watchdog
+	workerID atomic.Uint64              // goroutine of the worker
+
+	checkpointInterval time.Duration
+	checkpointMode     string
+
+	groupMax   int           // writes per transaction of WithGroupCommit, no grouping below 2
+	groupDelay time.Duration // how long the worker waits for the next write of a group
+
+	commitHook      func() int // WithCommitHook
+	rollbackHook    func()     // WithRollbackHook
+	onCommit        []func()
+	onRollback      []func()
+	onChange        []func(op ChangeOp, table string, rowid int64)
+	txHooksMu       sync.RWMutex
+	autocommitHooks bool
+	tx              txTracker
+
+	readers     int
+	replica     string       // file of WithReadReplica
+	readPool    bool         // WithReadPool sends the SELECT queries to the readers
+	readDB      *sql.DB      // read-only connections of NewRead, nil without readers
+	exclusiveMu sync.RWMutex // held by the readers' jobs, taken over by Exclusive and Pause
+
+	pauseMu sync.Mutex
+	paused  bool
+
+	featuresMu sync.Mutex
+	features   *features // detected by Supports, nil until a detection succeeds
+
+	metrics metrics
+
+	txTimeout  time.Duration
+	jobTimeout time.Duration
+	closing    chan struct{} // closed when Close begins
+
+	closeMu  sync.RWMutex
+	closed   bool
+	inflight sync.WaitGroup // dispatched items the worker is not done with
+	work     sync.Map       // same items, by workID, to abandon them
+	deferred sync.Map       // items of NewAfter waiting for their dependency, by workID, for Flush
+
+	lifeMu           sync.Mutex // serializes Close and Reopen
+	queueWhileClosed bool
+	parked           []*workItem // submitted while closed, for Reopen
+	parkedMu         sync.Mutex
+	pragmas          []string // statements of SetPragma, replayed by Reopen
+	pragmasMu        sync.Mutex
 }
 
 type ComfyOption func(*ComfyDB)
@@ -83,6 +244,14 @@ func WithPath(path string) ComfyOption {
 	}
 }
 
+// WithCreateDir creates the missing directories of the path of WithPath with perm when the database opens.
+func WithCreateDir(perm os.FileMode) ComfyOption {
+	return func(o *ComfyDB) {
+		o.createDir = true
+		o.dirPerm = perm
+	}
+}
+
 // WithMemory sets the database to be in-memory.
 func WithMemory() ComfyOption {
 	return func(o *ComfyDB) {
@@ -90,6 +259,18 @@ func WithMemory() ComfyOption {
 	}
 }
 
+// WithSharedMemory sets the database to be a named in-memory database, `file:name?mode=memory&cache=shared`,
+// that every connection of the process opening the same name sees: the readers of WithReaders, or your own sql.Open.
+// ComfyDB keeps a connection open until Close so the database outlives idle periods.
+// The shared cache locks tables: a reader hitting a table being written gets SQLITE_LOCKED (see WithBusyRetry).
+func WithSharedMemory(name string) ComfyOption {
+	return func(o *ComfyDB) {
+		o.sharedMemory = name
+		o.conn = fmt.Sprintf(sharedMemoryConn, name)
+		o.memory = true
+	}
+}
+
 // WithConnection sets a custom connection string for the database.
 func WithConnection(conn string) ComfyOption {
 	return func(o *ComfyDB) {
@@ -97,12 +278,177 @@ func WithConnection(conn string) ComfyOption {
 	}
 }
 
+// WithDSN opens the database with dsn used verbatim, by the worker and by the driver of OpenDB,
+// for the query parameters of the driver ComfyDB doesn't know about (`vfs`, `_txlock=immediate`...).
+// Nothing is added to it: New fails when it's combined with an option that would change the connection string
+// (WithPath, WithSharedMemory, WithConnection, WithReadOnly, WithAutoVacuum, WithCreateDir),
+// and NewRead runs on the worker.
+func WithDSN(dsn string) ComfyOption {
+	return func(o *ComfyDB) {
+		o.dsn = dsn
+	}
+}
+
+// WithDriver opens the database with another registered database/sql driver than "sqlite3", like "sqlite" of
+// modernc.org/sqlite, imported by your program. The queue, transactions, migrations and the OpenDB driver work the
+// same, and the connection strings comfylite3 builds pass their pragmas as `_pragma=name(value)`, the syntax of
+// modernc.org/sqlite and ncruces/go-sqlite3. What needs the connection of mattn/go-sqlite3 fails with an error
+// instead: RegisterFunc and the other custom functions, the backup API, commit and rollback hooks, OnChange,
+// Interrupt, and the connect hooks of WithBusyTimeout, WithJournalMode and the like.
+//
+// Built with CGO_ENABLED=0 or the comfylite3_nomattn tag, the package leaves mattn/go-sqlite3 out altogether:
+// pass WithDriver then, or register a driver of your own as "sqlite3".
 func WithDriver(driver string) ComfyOption {
 	return func(o *ComfyDB) {
 		o.driver = driver
 	}
 }
 
+// WithEcho prints every statement executed through the sql.DB-like methods and
+// the OpenDB driver to stderr, like the `.echo on` command of the sqlite3 CLI.
+// Statements run inside your own New callbacks are not known to ComfyDB and are not echoed.
+func WithEcho() ComfyOption {
+	return func(c *ComfyDB) {
+		c.echo = os.Stderr
+	}
+}
+
+// QueryEvent describes a job run by the worker, or a statement of a transaction opened through OpenDB.
+type QueryEvent struct {
+	ID       uint64 // ticket of the job, of the transaction's job for its statements
+	Query    string // SQL of the jobs and statements submitted through OpenDB, empty for New callbacks
+	Args     int    // number of arguments bound to Query
+	Start    time.Time
+	Duration time.Duration
+	Err      error // what the ticket delivered, nil on success
+}
+
+// WithLogger calls fn after every job the worker runs, and after every statement of a transaction opened through OpenDB.
+// fn runs on the worker: keep it fast, and don't wait for a job from it.
+func WithLogger(fn func(QueryEvent)) ComfyOption {
+	return func(c *ComfyDB) {
+		c.logger = fn
+	}
+}
+
+// JobInfo describes the job, or the statement of a transaction opened through OpenDB, passed to the WithHook functions.
+type JobInfo struct {
+	ID       uint64 // ticket of the job, of the transaction's job for its statements
+	Query    string // SQL of the jobs and statements submitted through OpenDB, empty for New callbacks
+	Args     int    // number of arguments bound to Query
+	Priority int
+	Read     bool // runs on a reader of WithReaders
+}
+
+// Functions of WithHook.
+type jobHook struct {
+	before func(JobInfo)
+	after  func(JobInfo, interface{}, error, time.Duration)
+}
+
+// WithHook calls before right before every job runs, and after once it ran with what its ticket receives and how long
+// it took, to log, measure or audit them in one place. The statements of the transactions opened through OpenDB are
+// reported one by one. Either function may be nil, hooks added by several WithHook run in that order.
+// They run on the worker, or on a reader: keep them fast, and don't wait for a job from them.
+func WithHook(before func(JobInfo), after func(info JobInfo, result interface{}, err error, duration time.Duration)) ComfyOption {
+	return func(c *ComfyDB) {
+		c.hooks = append(c.hooks, jobHook{before: before, after: after})
+	}
+}
+
+// Call the before functions of WithHook.
+func (c *ComfyDB) beforeHooks(info JobInfo) {
+	for _, hook := range c.hooks {
+		if hook.before != nil {
+			c.callHook(func() { hook.before(info) })
+		}
+	}
+}
+
+// Call the after functions of WithHook.
+func (c *ComfyDB) afterHooks(info JobInfo, result interface{}, err error, duration time.Duration) {
+	for _, hook := range c.hooks {
+		if hook.after != nil {
+			c.callHook(func() { hook.after(info, result, err, duration) })
+		}
+	}
+}
+
+// SlowQuery describes a job, or a statement of a transaction opened through OpenDB, slower than WithSlowQueryThreshold.
+type SlowQuery struct {
+	JobInfo
+	Duration  time.Duration // running
+	QueueWait time.Duration // waiting for the worker beforehand
+}
+
+// WithSlowQueryThreshold calls handler for every job running longer than threshold, with its SQL, how long it ran
+// and how long it waited in the queue. handler runs on the worker: keep it fast, and don't wait for a job from it.
+func WithSlowQueryThreshold(threshold time.Duration, handler func(SlowQuery)) ComfyOption {
+	return func(c *ComfyDB) {
+		c.slowThreshold = threshold
+		c.onSlow = handler
+	}
+}
+
+// Report a job slower than WithSlowQueryThreshold.
+func (c *ComfyDB) checkSlow(info JobInfo, duration, queueWait time.Duration) {
+	if c.onSlow == nil || duration < c.slowThreshold {
+		return
+	}
+	c.callHook(func() { c.onSlow(SlowQuery{JobInfo: info, Duration: duration, QueueWait: queueWait}) })
+}
+
+// Report an event to the WithLogger callback.
+func (c *ComfyDB) logQuery(event QueryEvent) {
+	if c.logger != nil {
+		c.logger(event)
+	}
+}
+
+// WithTxTimeout sets how long a transaction opened through OpenDB may stay idle between two statements.
+// The worker is dedicated to an open transaction, so an abandoned one is rolled back after this delay to free it.
+// Defaults to 30 seconds.
+func WithTxTimeout(timeout time.Duration) ComfyOption {
+	return func(c *ComfyDB) {
+		c.txTimeout = timeout
+	}
+}
+
+// WithJobTimeout sets a deadline to every job, so a slow one doesn't stall the worker forever.
+// Past the deadline, the ticket receives ErrJobTimeout and the context of the job is done:
+// on the worker, SQLite aborts the statement in progress with SQLITE_INTERRUPT even if the function ignores its context,
+// the statement is rolled back while the previous statements of the job stay applied unless they were in a transaction.
+// A job of the readers is only stopped by the queries run with its context.
+func WithJobTimeout(timeout time.Duration) ComfyOption {
+	return func(c *ComfyDB) {
+		c.jobTimeout = timeout
+	}
+}
+
+// WithBusyRetry re-runs a job failing with SQLITE_BUSY or SQLITE_LOCKED up to maxRetries times,
+// waiting backoff before the first retry and doubling it each time.
+// The worker serializes jobs, so those errors come from other processes or attached databases holding a lock.
+//
+// A job is only re-run when it changed nothing before failing (total_changes() didn't move):
+// a job that applied some of its statements is never silently re-run, its error is returned as is.
+// Jobs wrapping their statements in a transaction are the safe way to benefit from retries.
+// The worker waits during the backoff, which delays every queued job.
+func WithBusyRetry(maxRetries int, backoff time.Duration) ComfyOption {
+	return func(c *ComfyDB) {
+		c.busyRetries = maxRetries
+		c.busyBackoff = backoff
+	}
+}
+
+// WithRetry is WithBusyRetry counted in attempts: a job failing with SQLITE_BUSY or SQLITE_LOCKED runs
+// at most maxAttempts times, its first run included, so WithRetry(1, backoff) never re-runs it.
+func WithRetry(maxAttempts int, backoff time.Duration) ComfyOption {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return WithBusyRetry(maxAttempts-1, backoff)
+}
+
 // Records your migrations for your database.
 func WithMigration(migrations ...Migration) ComfyOption {
 	return func(c *ComfyDB) {
@@ -111,43 +457,158 @@ func WithMigration(migrations ...Migration) ComfyOption {
 }
 
 // WithRetryAttempts sets maximum retry attempts for failed operations
+//
+// Deprecated: failed jobs were never retried and the option does nothing, use WithBusyRetry.
 func WithRetryAttempts(attempts int) ComfyOption {
-	return func(c *ComfyDB) {
-		c.poolOptions = append(c.poolOptions, retrypool.WithAttempts[*workItem](attempts))
-	}
+	return func(c *ComfyDB) {}
 }
 
 // WithRetryDelay sets delay between retries
+//
+// Deprecated: failed jobs were never retried and the option does nothing, use WithBusyRetry.
 func WithRetryDelay(delay time.Duration) ComfyOption {
-	return func(c *ComfyDB) {
-		c.poolOptions = append(c.poolOptions, retrypool.WithDelay[*workItem](delay))
-	}
+	return func(c *ComfyDB) {}
 }
 
-// WithPanicHandler sets custom panic handler
+// WithPanicHandler sets custom panic handler, called when a job panics,
+// or a function of OnCommit, OnRollback, OnChange or the Tracer of WithTracing, whose panics have no ticket to go to
 func WithPanicHandler(handler onPanic) ComfyOption {
 	return func(c *ComfyDB) {
-		c.poolOptions = append(c.poolOptions, retrypool.WithPanicHandler[*workItem](func(task *workItem, v interface{}, stackTrace string) {
-			handler(v, stackTrace)
-		}))
+		c.panicHandler = handler
+	}
+}
+
+// Echo a statement and its arguments when WithEcho is enabled.
+func (c *ComfyDB) echoQuery(query string, args []interface{}) {
+	if c.echo == nil {
+		return
+	}
+	if len(args) > 0 {
+		c.echof("%s -- args: %v", query, args)
+	} else {
+		c.echof("%s", query)
+	}
+}
+
+// Print a debug line when WithEcho is enabled.
+func (c *ComfyDB) echof(format string, args ...interface{}) {
+	if c.echo == nil {
+		return
 	}
+	c.echoMu.Lock()
+	defer c.echoMu.Unlock()
+	fmt.Fprintf(c.echo, format+"\n", args...)
 }
 
+// ErrClosed is delivered to the jobs submitted after Close, and to the jobs abandoned by CloseContext.
+var ErrClosed = errors.New("database is closed")
+
 // Close the database connection.
+// No new job is accepted but the queued ones are drained first, open driver transactions are rolled back.
 func (c *ComfyDB) Close() error {
-	// Close the retrypool
-	if err := c.pool.Shutdown(); err != nil {
-		if err != context.Canceled {
-			return err
+	return c.CloseContext(context.Background())
+}
+
+// CloseContext closes the database connection like Close, but only drains the queue until ctx is done.
+// The remaining jobs are then abandoned, the running one included, and their tickets receive ErrClosed:
+// every WaitFor, Result and WaitForChn still waiting returns it as the result so a type switch on it works.
+// A ctx already done abandons the queue right away, even the jobs the worker could have drained by then.
+func (c *ComfyDB) CloseContext(ctx context.Context) error {
+	_, err := c.Shutdown(ctx)
+	return err
+}
+
+// Shutdown closes the database connection like CloseContext and returns how many jobs it abandoned,
+// the running one included: zero when the queue was drained before ctx was done.
+func (c *ComfyDB) Shutdown(ctx context.Context) (int, error) {
+	abandoned := 0
+	c.lifeMu.Lock()
+	defer c.lifeMu.Unlock()
+
+	c.closeMu.Lock()
+	if !c.closed {
+		c.closed = true
+		// Release the worker if it's serving a transaction
+		close(c.closing)
+	} else {
+		// closing again gives up on Reopen
+		c.parkedMu.Lock()
+		for _, item := range c.parked {
+			if item.cancel(ErrClosed) {
+				abandoned++
+			}
+			c.release(item)
+			c.work.Delete(item.id)
+			if item.stop != nil {
+				item.stop()
+			}
+		}
+		c.parked = nil
+		c.parkedMu.Unlock()
+	}
+	c.closeMu.Unlock()
+
+	// a paused queue is drained all the same
+	c.Resume()
+
+	drained := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(drained)
+	}()
+
+	// The worker still hands out the queued jobs, then returns
+	c.queue.close()
+
+	if ctx.Err() != nil {
+		// a done ctx abandons the queue whether or not it happens to be drained already
+		abandoned += c.abandon()
+	} else {
+		select {
+		case <-drained:
+			<-c.stopped
+		case <-ctx.Done():
+			abandoned += c.abandon()
+		}
+	}
+
+	c.stmts.clear()
+
+	if c.readDB != nil {
+		if err := c.readDB.Close(); err != nil {
+			return abandoned, err
+		}
+	}
+
+	if c.keepAlive != nil {
+		c.keepConn.Close()
+		if err := c.keepAlive.Close(); err != nil {
+			return abandoned, err
 		}
 	}
 
 	// Close the database connection
-	return c.db.Close()
+	return abandoned, c.db.Close()
+}
+
+// Finish every outstanding ticket with ErrClosed, the running job included, and count them.
+func (c *ComfyDB) abandon() int {
+	abandoned := 0
+	c.work.Range(func(_, value interface{}) bool {
+		item := value.(*workItem)
+		if item.cancel(ErrClosed) || item.finish(workRunning, nil, ErrClosed) {
+			abandoned++
+		}
+		return true
+	})
+	return abandoned
 }
 
 // Prepare the eventual creation of the migration table.
 func (c *ComfyDB) prepareMigration() error {
+	if c.readOnly {
+		return nil
+	}
 	newTableID := c.New(func(db *sql.DB) (interface{}, error) {
 		_, err := db.Exec(fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %v (
@@ -157,7 +618,7 @@ func (c *ComfyDB) prepareMigration() error {
 		)`, c.migrationTableName))
 		return nil, err
 	})
-	result, err := c.WaitFor(newTableID)
+	result, err := c.await(newTableID)
 	if err != nil {
 		return err
 	}
@@ -167,8 +628,26 @@ func (c *ComfyDB) prepareMigration() error {
 	return nil
 }
 
+// Keep a connection open on the named in-memory database of WithSharedMemory.
+func (c *ComfyDB) holdSharedMemory() error {
+	keepAlive, err := sql.Open(c.driver, c.conn)
+	if err != nil {
+		return err
+	}
+	keepConn, err := keepAlive.Conn(context.Background())
+	if err != nil {
+		keepAlive.Close()
+		return fmt.Errorf("failed to hold the shared memory database %q: %w", c.sharedMemory, err)
+	}
+	c.keepAlive = keepAlive
+	c.keepConn = keepConn
+	return nil
+}
+
 // Sort the migrations by version.
 func (c *ComfyDB) sort() []Migration {
+	c.migrationsMu.Lock()
+	defer c.migrationsMu.Unlock()
 	cp := make([]Migration, len(c.migrations))
 	copy(cp, c.migrations)
 	sort.Slice(cp, func(i, j int) bool {
@@ -184,8 +663,11 @@ func New(opts ...ComfyOption) (*ComfyDB, error) {
 		memory:             true,
 		migrations:         []Migration{},
 		migrationTableName: "_migrations",
-		poolOptions:        make([]retrypool.Option[*workItem], 0),
+		queue:              newJobQueue(),
+		stopped:            make(chan struct{}),
 		driver:             "sqlite3",
+		txTimeout:          30 * time.Second,
+		closing:            make(chan struct{}),
 	}
 
 	c.count.Store(1)
@@ -194,86 +676,728 @@ func New(opts ...ComfyOption) (*ComfyDB, error) {
 		opt(c)
 	}
 
-	// Open the database connection
-	var err error
-	if c.conn != "" {
-		c.db, err = sql.Open(c.driver, c.conn)
+	if err := c.checkDSN(); err != nil {
+		return nil, err
+	}
+
+	if c.encrypted() {
+		// before anything reads the database
+		c.connectHooks = append([]connectHook{c.keyHook}, c.connectHooks...)
+	}
+	if c.journalMode != "" || c.synchronous != "" {
+		hook, err := c.journalHook()
+		if err != nil {
+			return nil, err
+		}
+		c.connectHooks = append(c.connectHooks, hook)
+	}
+	if c.cacheSize != nil || c.tempStore != "" || c.mmapSize != nil {
+		hook, err := c.pragmaHook()
+		if err != nil {
+			return nil, err
+		}
+		c.connectHooks = append(c.connectHooks, hook)
+	}
+	if c.groupDelay < 0 {
+		return nil, fmt.Errorf("invalid group commit delay %v", c.groupDelay)
+	}
+	if c.checkpointInterval > 0 && !checkpointModes[c.checkpointMode] {
+		return nil, fmt.Errorf("invalid checkpoint mode %q", c.checkpointMode)
+	}
+	if c.busyTimeout != nil {
+		if *c.busyTimeout < 0 {
+			return nil, fmt.Errorf("invalid busy timeout %v", *c.busyTimeout)
+		}
+		c.connectHooks = append(c.connectHooks, c.busyTimeoutHook)
+	}
+	if c.readOnly {
+		c.connectHooks = append(c.connectHooks, queryOnlyHook)
+	}
+	if c.mattn() {
+		c.connectHooks = append(c.connectHooks, c.txHook)
+	} else if c.commitHook != nil || c.rollbackHook != nil {
+		return nil, fmt.Errorf("commit and rollback hooks are only supported with the sqlite3 driver, got %q", c.driver)
+	}
+
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	// Start the single worker
+	go c.loop()
+
+	// Prepare migrations
+	if err := c.prepareMigration(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Open the database connections from the options.
+// WithDSN doesn't mix with the options building the connection string.
+func (c *ComfyDB) checkDSN() error {
+	if c.dsn == "" {
+		return nil
+	}
+	conflicts := []string{}
+	if c.path != "" {
+		conflicts = append(conflicts, "WithPath")
+	}
+	if c.sharedMemory != "" {
+		conflicts = append(conflicts, "WithSharedMemory")
+	} else if c.conn != "" {
+		conflicts = append(conflicts, "WithConnection")
+	}
+	if c.readOnly {
+		conflicts = append(conflicts, "WithReadOnly")
+	}
+	if c.autoVacuum != "" {
+		conflicts = append(conflicts, "WithAutoVacuum")
+	}
+	if c.createDir {
+		conflicts = append(conflicts, "WithCreateDir")
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("WithDSN can't be combined with %s", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+func (c *ComfyDB) connect() error {
+	var dsn string
+	if c.dsn != "" {
+		dsn = c.dsn
+	} else if c.sharedMemory != "" {
+		dsn = c.withPragmas(c.conn, busyTimeoutPragma)
+	} else if c.conn != "" {
+		dsn = c.conn
 	} else if c.memory {
-		c.db, err = sql.Open(c.driver, memoryConn)
+		dsn = c.withPragmas(memoryConn, busyTimeoutPragma)
 	} else {
 		if c.path == "" {
-			return nil, fmt.Errorf("path is required")
+			return fmt.Errorf("path is required")
+		}
+		if c.readOnly {
+			dsn = c.withPragmas(fmt.Sprintf(readOnlyFileConn, c.path), busyTimeoutPragma)
+		} else {
+			if err := c.prepareFile(); err != nil {
+				return err
+			}
+			dsn = c.withPragmas(fmt.Sprintf(fileConn, c.path), "journal_mode=WAL", busyTimeoutPragma)
 		}
-		c.db, err = sql.Open(c.driver, fmt.Sprintf(fileConn, c.path))
 	}
-
+	dsn, err := c.autoVacuumDSN(dsn)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if c.db, err = c.open(dsn, true); err != nil {
+		return err
 	}
 
 	c.db.SetMaxOpenConns(1)
 	c.db.SetMaxIdleConns(1)
 
-	// Initialize the retrypool with a single worker
-	c.pool = retrypool.New[*workItem](
-		context.Background(),
-		[]retrypool.Worker[*workItem]{c},
-		c.poolOptions...,
-	)
+	// Surface the failures of the connect hooks now rather than on the first job
+	if len(c.connectHooks) > 0 {
+		if err := c.db.Ping(); err != nil {
+			c.db.Close()
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+	}
 
-	// Prepare migrations
-	if err := c.prepareMigration(); err != nil {
-		return nil, err
+	if err := c.openReaders(); err != nil {
+		c.db.Close()
+		return err
 	}
 
-	return c, nil
+	if c.sharedMemory != "" {
+		if err := c.holdSharedMemory(); err != nil {
+			c.db.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// Create the database file, and its directory with WithCreateDir, so a failure comes with a clearer error than SQLite's
+// "unable to open database file".
+func (c *ComfyDB) prepareFile() error {
+	dir := filepath.Dir(c.path)
+	if c.createDir {
+		if err := os.MkdirAll(dir, c.dirPerm); err != nil {
+			return fmt.Errorf("failed to create directory %q: %w", dir, err)
+		}
+	} else if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("directory %q doesn't exist, see WithCreateDir: %w", dir, err)
+	}
+	file, err := os.OpenFile(c.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open database file %q: %w", c.path, err)
+	}
+	return file.Close()
+}
+
+// WithQueueWhileClosed keeps the jobs submitted after Close waiting for Reopen, instead of failing them with ErrClosed.
+// Closing again while closed fails them with ErrClosed.
+func WithQueueWhileClosed() ComfyOption {
+	return func(c *ComfyDB) {
+		c.queueWhileClosed = true
+	}
 }
 
-// Implement the Worker interface from retrypool
-func (c *ComfyDB) Run(ctx context.Context, item *workItem) error {
-	// Execute the function
-	res, err := item.fn(c.db)
+// Reopen reconnects a closed ComfyDB with its options and restarts the worker.
+// Custom functions, hooks and the pragmas set through SetPragma are applied again, the migration table is recreated
+// if it's gone (an in-memory database doesn't survive Close), then the jobs kept by WithQueueWhileClosed run.
+func (c *ComfyDB) Reopen() error {
+	c.lifeMu.Lock()
+	defer c.lifeMu.Unlock()
+
+	c.closeMu.RLock()
+	closed := c.closed
+	c.closeMu.RUnlock()
+	if !closed {
+		return fmt.Errorf("database is not closed")
+	}
+	// an abandoned job may still be running
+	<-c.stopped
+
+	if err := c.connect(); err != nil {
+		return fmt.Errorf("failed to reopen database: %w", err)
+	}
+
+	c.closeMu.Lock()
+	c.queue = newJobQueue()
+	c.stopped = make(chan struct{})
+	c.closing = make(chan struct{})
+	c.closed = false
+	c.closeMu.Unlock()
+
+	go c.loop()
+
+	// replayed ahead of the parked jobs
+	c.pragmasMu.Lock()
+	pragmas := append([]string(nil), c.pragmas...)
+	c.pragmasMu.Unlock()
+	pragmaID := c.New(func(db *sql.DB) (interface{}, error) {
+		for _, query := range pragmas {
+			c.echoQuery(query, nil)
+			if _, err := db.Exec(query); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	result, err := c.await(pragmaID)
+	if err == nil {
+		err, _ = result.(error)
+	}
+	if err == nil {
+		err = c.prepareMigration()
+	}
+
+	c.parkedMu.Lock()
+	parked := c.parked
+	c.parked = nil
+	c.parkedMu.Unlock()
+	for _, item := range parked {
+		c.dispatch(item)
+	}
 
-	// Store the result
 	if err != nil {
-		item.result <- err
+		return fmt.Errorf("failed to reopen database: %w", err)
+	}
+	return nil
+}
+
+// Run the queued jobs one at a time, until the queue is closed and empty.
+func (c *ComfyDB) loop() {
+	defer close(c.stopped)
+	if c.watchdog > 0 {
+		c.workerID.Store(goroutineID())
+		go c.watch(c.stopped)
+	}
+	if c.checkpointInterval > 0 {
+		go c.checkpointEvery(c.stopped)
+	}
+	for {
+		item, ok := c.queue.pop()
+		if !ok {
+			return
+		}
+		if item.group {
+			c.runGroup(item)
+			continue
+		}
+		c.runWatched(item)
+	}
+}
+
+// Run a queued work item under the watchdog.
+func (c *ComfyDB) runWatched(item *workItem) {
+	if c.watchdog > 0 {
+		c.running.Store(&runningJob{id: item.id, start: time.Now()})
+	}
+	c.run(item)
+	c.running.Store(nil)
+}
+
+// Run a dispatched work item and release its waiters.
+func (c *ComfyDB) run(item *workItem) {
+	defer func() {
+		c.work.Delete(item.id)
+		c.inflight.Done()
+	}()
+
+	if item.stop != nil {
+		defer item.stop()
+	}
+
+	c.metrics.pending.Add(-1)
+	wait := time.Since(item.queuedAt)
+	c.release(item)
+
+	// The work was cancelled while queued
+	if !item.start() {
+		return
+	}
+
+	jobCtx := item.ctx
+	if jobCtx == nil {
+		jobCtx = context.Background()
+	}
+	if item.timeout > 0 {
+		var cancel context.CancelFunc
+		jobCtx, cancel = context.WithTimeoutCause(jobCtx, item.timeout, ErrJobTimeout)
+		defer cancel()
+		// Release the waiters at the deadline, even if the function ignores its context
+		expire := context.AfterFunc(jobCtx, func() {
+			if context.Cause(jobCtx) == ErrJobTimeout {
+				item.finish(workRunning, nil, ErrJobTimeout)
+			}
+		})
+		defer expire()
+	}
+
+	// Execute the function and store the result
+	start := time.Now()
+	if item.read {
+		// Exclusive holds the readers off too
+		c.exclusiveMu.RLock()
+	}
+	if !item.read {
+		c.interruptible(item.id)
+		// stop SQLite at the deadline or when the context is done
+		stopInterrupt := context.AfterFunc(jobCtx, func() {
+			c.interruptJob(item.id)
+		})
+		defer stopInterrupt()
+	}
+	info := JobInfo{ID: item.id, Query: item.query, Args: item.args, Priority: item.priority, Read: item.read}
+	c.beforeHooks(info)
+	endSpan := c.startSpan(item.ctx, info, wait)
+	c.logJob(slog.LevelDebug, "comfylite3: job started", item)
+	value, err := c.execute(jobCtx, item)
+	err = classifyError(err)
+	if item.read {
+		c.exclusiveMu.RUnlock()
 	} else {
-		item.result <- res
+		c.interruptible(0)
+		c.fireTxHooks()
+	}
+	duration := time.Since(start)
+	// account for the job before releasing its waiters, already done means it timed out
+	timedOut := item.state.Load() == workDone
+	c.metrics.record(duration, wait, err != nil || timedOut)
+	if item.batch != nil {
+		// released once its group commits
+		item.batch.add(item, value, err)
+	} else {
+		item.finish(workRunning, value, err)
 	}
-	close(item.result)
 
-	return nil
+	if err == nil && timedOut {
+		err = ErrJobTimeout
+	}
+	c.logQuery(QueryEvent{ID: item.id, Query: item.query, Args: item.args, Start: start, Duration: duration, Err: err})
+	c.logFinished(item, duration, err)
+	c.afterHooks(info, value, err, duration)
+	c.checkSlow(info, duration, wait)
+	endSpan(err)
+}
+
+// PanicError is delivered on the ticket of a job that panicked, the worker keeps processing the next jobs.
+type PanicError struct {
+	Value interface{} // what the job panicked with
+	Stack string      // stack trace of the worker when it panicked
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("job panicked: %v\n%s", e.Value, e.Stack)
 }
 
-// New adds a new SQL function to be executed
+// Call the function of a job, turning a panic into a PanicError.
+func (c *ComfyDB) call(ctx context.Context, item *workItem) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stackTrace := string(debug.Stack())
+			if c.panicHandler != nil {
+				c.panicHandler(r, stackTrace)
+			}
+			value, err = nil, &PanicError{Value: r, Stack: stackTrace}
+		}
+	}()
+	return item.fn(ctx, c.dbOf(item))
+}
+
+// Call a hook registered by the user, a panic goes to the panic handler rather than bringing the worker down.
+func (c *ComfyDB) callHook(fn func()) {
+	defer func() {
+		if r := recover(); r != nil && c.panicHandler != nil {
+			c.panicHandler(r, string(debug.Stack()))
+		}
+	}()
+	fn()
+}
+
+// Database running the work item.
+func (c *ComfyDB) dbOf(item *workItem) *sql.DB {
+	if item.read {
+		return c.readDB
+	}
+	return c.db
+}
+
+// Call the function of a job, re-running it on SQLITE_BUSY/SQLITE_LOCKED as configured by WithBusyRetry.
+func (c *ComfyDB) execute(ctx context.Context, item *workItem) (interface{}, error) {
+	if c.busyRetries <= 0 {
+		return c.call(ctx, item)
+	}
+
+	before, errBefore := totalChanges(c.dbOf(item))
+	value, err := c.call(ctx, item)
+	backoff := c.busyBackoff
+	for attempt := 0; attempt < c.busyRetries && isBusy(err); attempt++ {
+		// A job that changed something before failing may be partially applied, re-running it isn't safe
+		if after, errAfter := totalChanges(c.dbOf(item)); errBefore != nil || errAfter != nil || after != before {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return value, err
+		}
+		backoff *= 2
+		value, err = c.call(ctx, item)
+	}
+	return value, err
+}
+
+// Number of rows changed since the connection opened.
+func totalChanges(db *sql.DB) (int64, error) {
+	var changes int64
+	err := db.QueryRow("SELECT total_changes()").Scan(&changes)
+	return changes, err
+}
+
+// New adds a new SQL function to be executed.
+//
+// The jobs run one at a time on the worker. Jobs of the same priority run in the order they entered the queue:
+// a job submitted after New returned runs after it, even from another goroutine, while the order of concurrent
+// submissions is the order they reach the queue, not the order of their workIDs.
+// Jobs of NewWithPriority overtake the queued jobs of lower priority, and the jobs of NewRead
+// run on the readers next to the worker: use NewAfter to order a job after one of them.
 func (c *ComfyDB) New(fn SqlFn) uint64 {
+	item := c.newWorkItem(withoutContext(fn))
+
+	// Store the work item
+	c.results.Store(item.id, item)
+
+	c.dispatch(item)
+
+	return item.id
+}
+
+// NewAfter adds a new SQL function to be executed once the job of dep is done, whatever its outcome,
+// whichever priority, reader or queue it ran on. It enters the queue then, behind the jobs submitted meanwhile.
+// An unknown dep, or one already forgotten and done, doesn't hold it back.
+func (c *ComfyDB) NewAfter(dep uint64, fn SqlFn) uint64 {
+	item := c.newWorkItem(withoutContext(fn))
+
+	// Store the work item
+	c.results.Store(item.id, item)
 
+	value, ok := c.results.Load(dep)
+	if !ok {
+		value, ok = c.work.Load(dep)
+	}
+	if !ok {
+		c.dispatch(item)
+		return item.id
+	}
+	select {
+	case <-value.(*workItem).done:
+		c.dispatch(item)
+	default:
+		c.deferred.Store(item.id, item)
+		go func() {
+			<-value.(*workItem).done
+			c.dispatch(item)
+			c.deferred.Delete(item.id)
+		}()
+	}
+	return item.id
+}
+
+// NewContext adds a new SQL function to be executed, unless ctx is done before the worker picks it up:
+// the function is then dropped and WaitFor delivers ctx.Err() right away.
+// Once running, its statement in progress is interrupted when ctx is done (see Interrupt), the function itself keeps running.
+func (c *ComfyDB) NewContext(ctx context.Context, fn SqlFn) uint64 {
+	return c.newContext(ctx, withoutContext(fn))
+}
+
+// Submit a function bound to ctx, it receives the context of its job (ctx with the job timeout).
+func (c *ComfyDB) newContext(ctx context.Context, fn SqlContextFn) uint64 {
+	return c.submitContext(ctx, c.newWorkItem(fn))
+}
+
+// Submit a query of the OpenDB driver bound to ctx, see newContext.
+func (c *ComfyDB) newQuery(ctx context.Context, query string, args []interface{}, fn SqlContextFn) uint64 {
+	item := c.newWorkItem(fn)
+	item.query = query
+	item.args = len(args)
+	item.group = c.groupable(query)
+	return c.submitContext(ctx, item)
+}
+
+func (c *ComfyDB) submitContext(ctx context.Context, item *workItem) uint64 {
+	item.ctx = ctx
+	if priority, ok := ctx.Value(priorityKey{}).(int); ok {
+		item.priority = priority
+	}
+
+	// Store the work item
+	c.results.Store(item.id, item)
+
+	if err := ctx.Err(); err != nil {
+		item.cancel(err)
+		return item.id
+	}
+	item.stop = context.AfterFunc(ctx, func() {
+		if item.cancel(ctx.Err()) {
+			c.unqueue(item)
+		}
+	})
+
+	c.dispatch(item)
+
+	return item.id
+}
+
+// NewWithTimeout adds a new SQL function to be executed with its own timeout, overriding WithJobTimeout (zero disables it).
+// At the deadline, the statement running on the worker is interrupted, with or without the context the function receives,
+// and its ticket receives ErrJobTimeout.
+func (c *ComfyDB) NewWithTimeout(timeout time.Duration, fn SqlContextFn) uint64 {
+	item := c.newWorkItem(fn)
+	item.timeout = timeout
+
+	// Store the work item
+	c.results.Store(item.id, item)
+
+	c.dispatch(item)
+
+	return item.id
+}
+
+// NewWithPriority adds a new SQL function to be executed ahead of the queued jobs of lower priority.
+// New uses priority 0, so jobs of the same priority run in submission order.
+// Low priority jobs are not starved: the oldest queued job is served after being overtaken 32 times in a row.
+func (c *ComfyDB) NewWithPriority(priority int, fn SqlFn) uint64 {
+	item := c.newWorkItem(withoutContext(fn))
+	item.priority = priority
+
+	// Store the work item
+	c.results.Store(item.id, item)
+
+	c.dispatch(item)
+
+	return item.id
+}
+
+// Context key of ContextWithPriority.
+type priorityKey struct{}
+
+// ContextWithPriority returns a copy of ctx giving its jobs a priority, like NewWithPriority does:
+// the jobs of NewContext, DoContext, ExecContext, QueryContext and the statements of OpenDB run with ctx.
+// A health check or an interactive request can then overtake a bulk import without a job of its own.
+func ContextWithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// Adapt a callback that doesn't care about the context of its job.
+func withoutContext(fn SqlFn) SqlContextFn {
+	return func(ctx context.Context, db *sql.DB) (interface{}, error) {
+		return fn(db)
+	}
+}
+
+// Create a work item with a fresh workID.
+func (c *ComfyDB) newWorkItem(fn SqlContextFn) *workItem {
 	// Check if we're about to overflow and reset if necessary
 	if c.count.Load() == math.MaxUint64 {
 		c.count.Store(1) // Reset to 1
 	}
 
-	item := &workItem{
-		id:     c.count.Add(1),
-		fn:     fn,
-		result: make(chan interface{}, 1),
+	return &workItem{
+		id:      c.count.Add(1),
+		fn:      fn,
+		timeout: c.jobTimeout,
+		done:    make(chan struct{}),
 	}
+}
 
-	// Store the work item
+// ErrQueueFull is returned by TryNew when WithMaxQueue jobs are already waiting for the worker.
+var ErrQueueFull = errors.New("queue is full")
+
+// WithMaxQueue bounds the jobs waiting for the worker to n: once n are waiting, New and the other submissions block
+// until the worker picks one up, or ctx is done for NewContext. TryNew fails with ErrQueueFull instead.
+// The running job doesn't count, nor the jobs kept by WithQueueWhileClosed.
+func WithMaxQueue(n int) ComfyOption {
+	return func(c *ComfyDB) {
+		if n > 0 {
+			c.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithQueueSize is WithMaxQueue under another name.
+func WithQueueSize(n int) ComfyOption {
+	return WithMaxQueue(n)
+}
+
+// WithRejectWhenFull makes every submission fail rather than block once WithMaxQueue jobs are waiting for the worker:
+// the ticket delivers ErrQueueFull right away, Exec and the other helpers return it, and onReject is called
+// with the workID when it's not nil, to count or log the dropped jobs. Use it to shed load under sustained overload.
+func WithRejectWhenFull(onReject func(workID uint64)) ComfyOption {
+	return func(c *ComfyDB) {
+		c.reject = true
+		c.onReject = onReject
+	}
+}
+
+// TryNew adds a new SQL function to be executed like New, unless WithMaxQueue jobs are already waiting:
+// it then returns ErrQueueFull rather than blocking.
+func (c *ComfyDB) TryNew(fn SqlFn) (uint64, error) {
+	item := c.newWorkItem(withoutContext(fn))
+	if c.slots != nil {
+		select {
+		case c.slots <- struct{}{}:
+			item.slot = true
+		default:
+			return 0, ErrQueueFull
+		}
+	}
 	c.results.Store(item.id, item)
+	c.dispatch(item)
+	return item.id, nil
+}
 
-	// Dispatch the work item to the retrypool
-	err := c.pool.Submit(item)
-	if err != nil {
-		// Handle the error appropriately
-		// For now, let's panic
-		panic(fmt.Sprintf("Failed to dispatch work item: %v", err))
+// Wait for a place in the queue of WithMaxQueue.
+// Without one when the database closes, dispatch fails the item or keeps it for Reopen, or when its context is done.
+// False when WithRejectWhenFull rejected the item.
+func (c *ComfyDB) reserve(item *workItem) bool {
+	if c.slots == nil || item.slot {
+		return true
+	}
+	if c.reject {
+		select {
+		case c.slots <- struct{}{}:
+			item.slot = true
+			return true
+		default:
+		}
+		if item.stop != nil {
+			item.stop()
+		}
+		if item.cancel(ErrQueueFull) {
+			c.logJob(slog.LevelWarn, "comfylite3: queue is full, job rejected", item)
+			if c.onReject != nil {
+				c.onReject(item.id)
+			}
+		}
+		return false
+	}
+	select {
+	case c.slots <- struct{}{}:
+		item.slot = true
+		return true
+	default:
+	}
+	c.logJob(slog.LevelWarn, "comfylite3: queue is full, the submission waits", item, slog.Int("size", cap(c.slots)))
+	c.closeMu.RLock()
+	closing := c.closing
+	c.closeMu.RUnlock()
+	var done <-chan struct{}
+	if item.ctx != nil {
+		done = item.ctx.Done()
 	}
+	select {
+	case c.slots <- struct{}{}:
+		item.slot = true
+	case <-closing:
+	case <-done:
+		// already cancelled by submitContext
+	}
+	return true
+}
 
-	return item.id
+// Give the place of the item in the queue back.
+func (c *ComfyDB) release(item *workItem) {
+	if item.slot {
+		item.slot = false
+		<-c.slots
+	}
+}
+
+// Dispatch the work item to the worker's queue
+func (c *ComfyDB) dispatch(item *workItem) {
+	if !c.reserve(item) {
+		return
+	}
+
+	c.closeMu.RLock()
+	defer c.closeMu.RUnlock()
+
+	if c.closed {
+		if c.queueWhileClosed {
+			c.parkedMu.Lock()
+			c.parked = append(c.parked, item)
+			c.parkedMu.Unlock()
+			// still reachable by Cancel
+			c.work.Store(item.id, item)
+			return
+		}
+		item.cancel(ErrClosed)
+		c.release(item)
+		return
+	}
+
+	c.inflight.Add(1)
+	c.work.Store(item.id, item)
+	c.metrics.pending.Add(1)
+	item.queuedAt = time.Now()
+	c.logJob(slog.LevelDebug, "comfylite3: job enqueued", item, slog.Int("priority", item.priority), slog.Int64("pending", c.metrics.pending.Load()))
+	if item.read {
+		// database/sql queues the readers beyond the size of the pool
+		go c.run(item)
+		return
+	}
+	c.queue.push(item)
 }
 
 // WaitFor waits for the result of a workID (your query).
+// Any number of goroutines can wait for the same workID, they all get the same result, and waiting again once the job
+// is done returns its result right away. Results are kept until Forget.
 func (c *ComfyDB) WaitFor(workID uint64) (interface{}, error) {
 	value, ok := c.results.Load(workID)
 	if !ok {
@@ -283,16 +1407,240 @@ func (c *ComfyDB) WaitFor(workID uint64) (interface{}, error) {
 
 	// Wait for the result
 	select {
-	case res := <-item.result:
-		// Delete the item from the results map after consuming the result
-		c.results.Delete(workID)
-		return res, nil
+	case <-item.done:
+		return item.outcome(), nil
 	case <-time.After(30 * time.Second):
-		return nil, fmt.Errorf("timeout waiting for result")
+		return nil, ErrWaitTimeout
 	}
 }
 
-// WaitForChn waits for the result of a workID (your query) and returns a channel.
+// ErrWaitTimeout is returned when a job isn't done by the end of the wait, see WaitForTimeout. The job goes on.
+var ErrWaitTimeout = errors.New("timeout waiting for result")
+
+// WaitForTimeout waits for the result of a workID like WaitFor, for d at most rather than 30 seconds:
+// it returns ErrWaitTimeout then and the job goes on.
+func (c *ComfyDB) WaitForTimeout(workID uint64, d time.Duration) (interface{}, error) {
+	ctx, cancel := context.WithTimeoutCause(context.Background(), d, ErrWaitTimeout)
+	defer cancel()
+	result, err := c.WaitForCtx(ctx, workID)
+	if err != nil && ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+	return result, err
+}
+
+// Poll returns the result of a workID like WaitFor without waiting, done being false while the job is queued or running.
+func (c *ComfyDB) Poll(workID uint64) (result interface{}, done bool, err error) {
+	value, ok := c.results.Load(workID)
+	if !ok {
+		return nil, false, fmt.Errorf("workID not found")
+	}
+	item := value.(*workItem)
+	select {
+	case <-item.done:
+		return item.outcome(), true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// WaitForCtx waits for the result of a workID like WaitFor, until ctx is done: it returns ctx.Err() then
+// and the job goes on, submit it with NewContext to drop it at the same time.
+func (c *ComfyDB) WaitForCtx(ctx context.Context, workID uint64) (interface{}, error) {
+	value, ok := c.results.Load(workID)
+	if !ok {
+		return nil, fmt.Errorf("workID not found")
+	}
+	item := value.(*workItem)
+
+	select {
+	case <-item.done:
+		return item.outcome(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Forget releases the result of a workID: waiting for it afterwards fails with "workID not found".
+// Every result stays in memory until then, forget the workIDs you're done with.
+// The helpers giving no workID (Exec, Query, Do...) forget theirs on their own.
+func (c *ComfyDB) Forget(workID uint64) {
+	c.results.Delete(workID)
+}
+
+// WaitFor a job submitted by comfylite3 itself, whose workID nobody else knows, and forget it.
+// There is no 30 seconds limit: a long VACUUM INTO or backup step is still writing when WaitFor gives up.
+func (c *ComfyDB) await(workID uint64) (interface{}, error) {
+	value, ok := c.results.Load(workID)
+	if !ok {
+		return nil, fmt.Errorf("workID not found")
+	}
+	defer c.Forget(workID)
+	item := value.(*workItem)
+	<-item.done
+	return item.outcome(), nil
+}
+
+// Result of a job submitted by comfylite3 itself, see await. Unlike Result it waits as long as the job runs,
+// until ctx is done: giving up sooner would report a failure while the job goes on, and may still commit.
+func (c *ComfyDB) awaitResult(ctx context.Context, workID uint64) (interface{}, error) {
+	value, ok := c.results.Load(workID)
+	if !ok {
+		return nil, fmt.Errorf("workID not found")
+	}
+	defer c.Forget(workID)
+	item := value.(*workItem)
+	select {
+	case <-item.done:
+		return item.value, item.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Outcome of a job submitted by comfylite3 itself like WaitForChn delivers it, see await.
+func (c *ComfyDB) awaitOutcome(workID uint64) interface{} {
+	value, ok := c.results.Load(workID)
+	if !ok {
+		return nil
+	}
+	defer c.Forget(workID)
+	item := value.(*workItem)
+	<-item.done
+	return item.outcome()
+}
+
+// NewBatch submits the functions in order and returns their workIDs in the same order, see WaitForAll.
+func (c *ComfyDB) NewBatch(fns []func(db *sql.DB) (interface{}, error)) []uint64 {
+	ids := make([]uint64, len(fns))
+	for i, fn := range fns {
+		ids[i] = c.New(fn)
+	}
+	return ids
+}
+
+// WaitForAll waits for every workID and returns their results in the same order.
+// Each slot holds what WaitFor would return: the value, or the error of that job alone.
+func (c *ComfyDB) WaitForAll(ids ...uint64) []interface{} {
+	results := make([]interface{}, len(ids))
+	for i, id := range ids {
+		result, err := c.WaitFor(id)
+		if err != nil {
+			result = err
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// Flush returns once every job submitted before the call is done, on the worker and on the readers, or ctx.Err()
+// when ctx is done first: a barrier to read your writes through OpenDB, OpenReadDB or WithReadPool.
+// The jobs parked while closed for Reopen are waited for too, and so are those of NewAfter still waiting
+// for their dependency. Flush doesn't forget any ticket.
+func (c *ComfyDB) Flush(ctx context.Context) error {
+	var pending []*workItem
+	collect := func(_, value interface{}) bool {
+		pending = append(pending, value.(*workItem))
+		return true
+	}
+	// a deferred item is dispatched before it leaves deferred: it is in one of them or done
+	c.deferred.Range(collect)
+	c.work.Range(collect)
+	for _, item := range pending {
+		select {
+		case <-item.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// WaitAny waits for the first of the workIDs to be done and returns it with what WaitFor would return.
+// The other jobs go on, wait for them again or Forget them.
+func (c *ComfyDB) WaitAny(ids ...uint64) (uint64, interface{}, error) {
+	if len(ids) == 0 {
+		return 0, nil, fmt.Errorf("no workID to wait for")
+	}
+	items := make([]*workItem, len(ids))
+	cases := make([]reflect.SelectCase, len(ids)+1)
+	for i, id := range ids {
+		value, ok := c.results.Load(id)
+		if !ok {
+			return 0, nil, fmt.Errorf("workID %d not found", id)
+		}
+		items[i] = value.(*workItem)
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(items[i].done)}
+	}
+	for i, item := range items {
+		// the first one in order among those done already
+		select {
+		case <-item.done:
+			return ids[i], item.outcome(), nil
+		default:
+		}
+	}
+	cases[len(ids)] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(time.After(30 * time.Second))}
+
+	chosen, _, _ := reflect.Select(cases)
+	if chosen == len(ids) {
+		return 0, nil, ErrWaitTimeout
+	}
+	return ids[chosen], items[chosen].outcome(), nil
+}
+
+// ErrCanceled is delivered on the ticket of a job dropped by Cancel.
+var ErrCanceled = errors.New("job canceled")
+
+// Cancel drops a job that is still queued: it leaves the queue, never runs and its ticket delivers ErrCanceled.
+// It returns false when the job already started, finished or doesn't exist.
+// A running job can't be stopped this way, submit it with NewContext and cancel the context instead.
+func (c *ComfyDB) Cancel(workID uint64) bool {
+	value, ok := c.work.Load(workID)
+	if !ok {
+		return false
+	}
+	item := value.(*workItem)
+	if !item.cancel(ErrCanceled) {
+		return false
+	}
+	c.unqueue(item)
+	return true
+}
+
+// Take a cancelled job out of the queue, its place in the queue of WithMaxQueue is given back right away
+// rather than when the worker reaches it. The worker takes care of a job it popped already.
+func (c *ComfyDB) unqueue(item *workItem) {
+	if !c.queue.remove(item) {
+		return
+	}
+	c.metrics.pending.Add(-1)
+	c.release(item)
+	if item.stop != nil {
+		item.stop()
+	}
+	c.work.Delete(item.id)
+	c.inflight.Done()
+}
+
+// Result waits for the result of a workID (your query) and returns exactly what your SqlFn returned.
+// Unlike WaitFor, an error returned as the value of your SqlFn is not mistaken for a failure.
+func (c *ComfyDB) Result(workID uint64) (interface{}, error) {
+	value, ok := c.results.Load(workID)
+	if !ok {
+		return nil, fmt.Errorf("workID not found")
+	}
+	item := value.(*workItem)
+
+	select {
+	case <-item.done:
+		return item.value, item.err
+	case <-time.After(30 * time.Second):
+		return nil, ErrWaitTimeout
+	}
+}
+
+// WaitForChn waits for the result of a workID (your query) and returns a channel, see WaitFor.
 func (c *ComfyDB) WaitForChn(workID uint64) <-chan interface{} {
 	value, ok := c.results.Load(workID)
 	if !ok {
@@ -306,10 +1654,8 @@ func (c *ComfyDB) WaitForChn(workID uint64) <-chan interface{} {
 	resultCh := make(chan interface{}, 1)
 
 	go func() {
-		res := <-item.result
-		// Delete the item from the results map after consuming the result
-		c.results.Delete(workID)
-		resultCh <- res
+		<-item.done
+		resultCh <- item.outcome()
 		close(resultCh)
 	}()
 
@@ -334,7 +1680,8 @@ func (c *ComfyDB) Up(ctx context.Context) error {
 
 	localSorted := c.sort()
 
-	migrationUpID := c.New(func(db *sql.DB) (interface{}, error) {
+	// Migrations are not subject to WithJobTimeout, a partial migration would be worse than a slow one
+	migrationUpID := c.NewWithTimeout(0, func(_ context.Context, db *sql.DB) (interface{}, error) {
 		tx, err := db.BeginTx(ctx, nil)
 		if err != nil {
 			return nil, err
@@ -363,7 +1710,7 @@ func (c *ComfyDB) Up(ctx context.Context) error {
 		}
 		return nil, tx.Commit()
 	})
-	result, err := c.WaitFor(migrationUpID)
+	result, err := c.await(migrationUpID)
 	if err != nil {
 		return err
 	}
@@ -392,21 +1739,28 @@ func (c *ComfyDB) Down(ctx context.Context, amount int) error {
 		amount = len(index)
 	}
 
-	migrationExists := map[uint]bool{}
-	for _, v := range index {
-		migrationExists[v] = true
-	}
+	return c.rollback(ctx, index[len(index)-amount:])
+}
 
-	localSorted := c.sort()
+// Roll back the applied migrations of the given versions, from the last one, in a single transaction.
+func (c *ComfyDB) rollback(ctx context.Context, versions []uint) error {
+	byVersion := map[uint]Migration{}
+	for _, migration := range c.sort() {
+		byVersion[migration.Version] = migration
+	}
 
-	migrationDownID := c.New(func(db *sql.DB) (interface{}, error) {
+	// Not subject to WithJobTimeout either
+	migrationDownID := c.NewWithTimeout(0, func(_ context.Context, db *sql.DB) (interface{}, error) {
 		tx, err := db.BeginTx(ctx, nil)
 		if err != nil {
 			return nil, err
 		}
 		defer tx.Rollback()
-		for i := len(index) - 1; i >= len(index)-amount; i-- {
-			migration := localSorted[index[i]-1]
+		for i := len(versions) - 1; i >= 0; i-- {
+			migration, ok := byVersion[versions[i]]
+			if !ok {
+				return nil, fmt.Errorf("migration (version=%v) doesn't exist", versions[i])
+			}
 
 			if migration.Version == 0 || migration.Label == "" {
 				return nil, fmt.Errorf("invalid migration: version and label must be set")
@@ -416,10 +1770,6 @@ func (c *ComfyDB) Down(ctx context.Context, amount int) error {
 				return nil, fmt.Errorf("invalid migration: up and down must be set")
 			}
 
-			if !migrationExists[migration.Version] {
-				return nil, fmt.Errorf("migration (version=%v, label=%s) doesn't exist", migration.Version, migration.Label)
-			}
-
 			if err := migration.Down(tx); err != nil {
 				return nil, err
 			}
@@ -430,7 +1780,7 @@ func (c *ComfyDB) Down(ctx context.Context, amount int) error {
 		}
 		return nil, tx.Commit()
 	})
-	result, err := c.WaitFor(migrationDownID)
+	result, err := c.await(migrationDownID)
 	if err != nil {
 		return err
 	}
@@ -440,6 +1790,57 @@ func (c *ComfyDB) Down(ctx context.Context, amount int) error {
 	return nil
 }
 
+// Migrate records the migrations, along with those of WithMigration, and applies the ones not applied yet, in order of version.
+// It's safe to call at every startup: the applied versions are tracked in the migration table.
+// Recording a migration twice is a no-op, two different migrations with the same version are an error.
+func (c *ComfyDB) Migrate(migrations []Migration) error {
+	c.migrationsMu.Lock()
+	for _, migration := range migrations {
+		known := false
+		for _, existing := range c.migrations {
+			if existing.Version != migration.Version {
+				continue
+			}
+			if existing.Label != migration.Label {
+				c.migrationsMu.Unlock()
+				return fmt.Errorf("conflicting migrations for version %v: %q and %q", migration.Version, existing.Label, migration.Label)
+			}
+			known = true
+		}
+		if !known {
+			c.migrations = append(c.migrations, migration)
+		}
+	}
+	c.migrationsMu.Unlock()
+
+	return c.Up(context.Background())
+}
+
+// MigrateDown rolls back the applied migrations above targetVersion, from the last one, in a single transaction.
+// A targetVersion of 0 rolls back everything.
+func (c *ComfyDB) MigrateDown(targetVersion uint) error {
+	if err := c.prepareMigration(); err != nil {
+		return err
+	}
+
+	index, err := c.Index()
+	if err != nil {
+		return err
+	}
+
+	versions := []uint{}
+	for _, version := range index {
+		if version > targetVersion {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	return c.rollback(context.Background(), versions)
+}
+
 // Get all versions of the migrations.
 func (c *ComfyDB) Index() ([]uint, error) {
 	currentIndexID := c.New(func(db *sql.DB) (interface{}, error) {
@@ -458,7 +1859,7 @@ func (c *ComfyDB) Index() ([]uint, error) {
 		}
 		return versions, nil
 	})
-	result, err := c.WaitFor(currentIndexID)
+	result, err := c.await(currentIndexID)
 	if err != nil {
 		return nil, err
 	}
@@ -497,7 +1898,7 @@ func (c *ComfyDB) Migrations() ([]Migration, error) {
 		}
 		return migrations, nil
 	})
-	result, err := c.WaitFor(migrationsID)
+	result, err := c.await(migrationsID)
 	if err != nil {
 		return nil, err
 	}
@@ -528,7 +1929,7 @@ func (c *ComfyDB) Version() (uint, error) {
 		}
 		return version, nil
 	})
-	result, err := c.WaitFor(versionID)
+	result, err := c.await(versionID)
 	if err != nil {
 		return 0, err
 	}
@@ -572,7 +1973,7 @@ func (c *ComfyDB) ShowTables() ([]string, error) {
 		}
 		return tables, nil
 	})
-	result, err := c.WaitFor(tablesID)
+	result, err := c.await(tablesID)
 	if err != nil {
 		return nil, err
 	}
@@ -605,7 +2006,7 @@ func (c *ComfyDB) ShowColumns(table string) ([]Column, error) {
 		}
 		return cols, nil
 	})
-	result, err := c.WaitFor(columnsID)
+	result, err := c.await(columnsID)
 	if err != nil {
 		return nil, err
 	}
@@ -622,5 +2023,5 @@ func (c *ComfyDB) ShowColumns(table string) ([]Column, error) {
 // RunSQL allows executing a custom SQL function and waits for its result.
 func (c *ComfyDB) RunSQL(fn SqlFn) (interface{}, error) {
 	workID := c.New(fn)
-	return c.WaitFor(workID)
+	return c.await(workID)
 }
@@ -0,0 +1,86 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// List the databases attached to the connection, by alias, with their file.
+func attachedDatabases(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("PRAGMA database_list")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	databases := map[string]string{}
+	for rows.Next() {
+		var seq int
+		var name string
+		var file sql.NullString
+		if err := rows.Scan(&seq, &name, &file); err != nil {
+			return nil, err
+		}
+		databases[name] = file.String
+	}
+	return databases, rows.Err()
+}
+
+// Attach attaches the database file at path under alias on the worker connection, `alias.table` is then usable in every job.
+// The connection lives as long as ComfyDB so the attachment persists until Detach.
+// SQLite can't attach nor detach inside a transaction: while one opened through OpenDB is in progress, Attach waits for its end in the queue.
+func (c *ComfyDB) Attach(path, alias string) error {
+	if !identifierPattern.MatchString(alias) {
+		return fmt.Errorf("invalid database alias %q", alias)
+	}
+	query := fmt.Sprintf("ATTACH DATABASE ? AS %s", alias)
+	attachID := c.New(func(db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, []interface{}{path})
+		return db.Exec(query, path)
+	})
+	result := c.awaitOutcome(attachID)
+	if err, ok := result.(error); ok {
+		return fmt.Errorf("failed to attach %q as %s: %w", path, alias, err)
+	}
+	return nil
+}
+
+// Detach detaches the database attached under alias, see Attach.
+func (c *ComfyDB) Detach(alias string) error {
+	if !identifierPattern.MatchString(alias) {
+		return fmt.Errorf("invalid database alias %q", alias)
+	}
+	query := fmt.Sprintf("DETACH DATABASE %s", alias)
+	detachID := c.New(func(db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, nil)
+		return db.Exec(query)
+	})
+	result := c.awaitOutcome(detachID)
+	if err, ok := result.(error); ok {
+		return fmt.Errorf("failed to detach %s: %w", alias, err)
+	}
+	return nil
+}
+
+// ExecOn executes a query meant for an attached database.
+// It fails clearly when the alias isn't attached instead of a "no such table" error,
+// the query itself is passed through unchanged so qualify your tables with `alias.table`.
+func (c *ComfyDB) ExecOn(alias string, query string, args ...interface{}) (sql.Result, error) {
+	execID := c.New(func(db *sql.DB) (interface{}, error) {
+		databases, err := attachedDatabases(db)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := databases[alias]; !ok {
+			return nil, fmt.Errorf("database %q is not attached", alias)
+		}
+		c.echoQuery(query, args)
+		return db.Exec(query, args...)
+	})
+	result := c.awaitOutcome(execID)
+	switch data := result.(type) {
+	case sql.Result:
+		return data, nil
+	default:
+		return nil, data.(error)
+	}
+}
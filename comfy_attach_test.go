@@ -0,0 +1,65 @@
+package comfylite3
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecOn(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if _, err := comfyMe.ExecOn("ref", "CREATE TABLE ref.codes (code TEXT)"); err == nil || !strings.Contains(err.Error(), "not attached") {
+		t.Fatalf("expected a not attached error, got %v", err)
+	}
+
+	if _, err := comfyMe.Exec("ATTACH DATABASE ? AS ref", filepath.Join(t.TempDir(), "ref.db")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.ExecOn("ref", "CREATE TABLE ref.codes (code TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.ExecOn("ref", "INSERT INTO ref.codes (code) VALUES (?)", "A1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAttach(t *testing.T) {
+	comfyMe, err := New(WithPath(filepath.Join(t.TempDir(), "main.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if err := comfyMe.Attach(filepath.Join(t.TempDir(), "reference.db"), "reference"); err != nil {
+		t.Fatal(err)
+	}
+	// the attachment outlives the job
+	if _, err := comfyMe.Exec("CREATE TABLE reference.countries (code TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO reference.countries VALUES ('FR'), ('BE')"); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := comfyMe.QueryRow("SELECT COUNT(*) FROM reference.countries").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 countries, got %d", count)
+	}
+
+	if err := comfyMe.Detach("reference"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.ExecOn("reference", "SELECT 1"); err == nil {
+		t.Fatal("expected the database to be detached")
+	}
+	if err := comfyMe.Attach("other.db", "bad alias"); err == nil {
+		t.Fatal("expected an invalid alias to be rejected")
+	}
+}
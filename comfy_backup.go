@@ -0,0 +1,113 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Backup copies the live database, in-memory included, to the file at destPath using SQLite's online backup API.
+// See BackupWithProgress.
+func (c *ComfyDB) Backup(destPath string) error {
+	return c.BackupWithProgress(destPath, nil)
+}
+
+// BackupWithProgress copies the live database to the file at destPath, replacing its content, and calls progress with
+// the pages left to copy and the total after each step.
+//
+// The copy runs on the worker a few pages at a time so the other jobs keep being served in between.
+// Their writes go through the same connection, SQLite carries them into the copy: the file holds the database as it is
+// when the last step runs.
+func (c *ComfyDB) BackupWithProgress(destPath string, progress func(remaining, total int)) error {
+	return c.backup(context.Background(), destPath, progress)
+}
+
+// BackupTo is Backup bound to ctx: once ctx is done the copy stops between two steps and returns ctx.Err(),
+// destPath is then left incomplete.
+func (c *ComfyDB) BackupTo(ctx context.Context, destPath string) error {
+	return c.backup(ctx, destPath, nil)
+}
+
+// BackupToWriter writes a backup of the live database to w, as a database file.
+// The backup is made like BackupTo in a temporary file, copied to w once complete and removed.
+func (c *ComfyDB) BackupToWriter(ctx context.Context, w io.Writer) error {
+	tmp, err := os.CreateTemp("", "comfylite3-backup-*.db")
+	if err != nil {
+		return fmt.Errorf("failed to create the backup file: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := c.backup(ctx, tmp.Name(), nil); err != nil {
+		return err
+	}
+	file, err := os.Open(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("failed to open the backup file: %w", err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("failed to write the backup: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces the content of the database with the database file at srcPath, in a single job.
+// Jobs queued after it see the restored database.
+func (c *ComfyDB) Restore(srcPath string) error {
+	return c.restore(context.Background(), srcPath)
+}
+
+// RestoreFrom replaces the content of the database with the database file read from r, a stream of BackupToWriter say.
+// r is first copied to a temporary file, then restored like Restore unless ctx is done before the job runs.
+func (c *ComfyDB) RestoreFrom(ctx context.Context, r io.Reader) error {
+	tmp, err := os.CreateTemp("", "comfylite3-restore-*.db")
+	if err != nil {
+		return fmt.Errorf("failed to create the restore file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the backup: %w", err)
+	}
+	return c.restore(ctx, tmp.Name())
+}
+
+// Persist writes a compact copy of the database, in-memory included, to the file at path with `VACUUM INTO`,
+// to reopen it later with WithPath. The copy is a single job, consistent without holding other jobs between steps
+// like Backup, written next to path and renamed over it: an existing file is replaced only once the copy is complete.
+// SQLite can't vacuum inside a transaction, Persist fails while one opened through OpenDB is in progress.
+func (c *ComfyDB) Persist(path string) error {
+	if open := c.openTxs.Load(); open > 0 {
+		return fmt.Errorf("can't persist while %d transactions are open", open)
+	}
+	tmpPath := path + ".tmp"
+	// VACUUM INTO refuses to overwrite a file
+	if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %q: %w", tmpPath, err)
+	}
+	persistID := c.New(func(db *sql.DB) (interface{}, error) {
+		c.echoQuery("VACUUM INTO ?", []interface{}{tmpPath})
+		_, err := db.Exec("VACUUM INTO ?", tmpPath)
+		return nil, err
+	})
+	result, err := c.await(persistID)
+	if err == nil {
+		if errResult, ok := result.(error); ok {
+			err = errResult
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to persist to %q: %w", path, err)
+	}
+	return nil
+}
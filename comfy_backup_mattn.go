@@ -0,0 +1,126 @@
+//go:build cgo && !comfylite3_nomattn
+
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Pages copied by each backup job, other jobs run between them.
+const backupPages = 256
+
+// Progress of a backup step.
+type backupStep struct {
+	done      bool
+	remaining int
+	total     int
+}
+
+// Copy the database to destPath with the backup API of mattn/go-sqlite3, a few pages per job.
+func (c *ComfyDB) backup(ctx context.Context, destPath string, progress func(remaining, total int)) error {
+	if !c.mattn() {
+		return fmt.Errorf("%w: backup requires the sqlite3 driver", ErrUnsupported)
+	}
+	dest, err := (&sqlite3.SQLiteDriver{}).Open(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup destination %q: %w", destPath, err)
+	}
+	defer dest.Close()
+	destConn := dest.(*sqlite3.SQLiteConn)
+
+	var backup *sqlite3.SQLiteBackup
+	var source *sqlite3.SQLiteConn
+	defer func() {
+		if backup == nil {
+			return
+		}
+		finishID := c.New(func(db *sql.DB) (interface{}, error) {
+			return nil, backup.Finish()
+		})
+		c.await(finishID)
+	}()
+
+	for {
+		// dropped once ctx is done, the backup is finished all the same
+		stepID := c.newContext(ctx, func(_ context.Context, db *sql.DB) (interface{}, error) {
+			var step backupStep
+			err := withRawConn(db, func(conn *rawConn) error {
+				if backup == nil {
+					var err error
+					if backup, err = destConn.Backup("main", conn, "main"); err != nil {
+						return err
+					}
+					source = conn
+				} else if conn != source {
+					return fmt.Errorf("worker connection changed during backup")
+				}
+				done, err := backup.Step(backupPages)
+				if err != nil {
+					return err
+				}
+				step = backupStep{done: done, remaining: backup.Remaining(), total: backup.PageCount()}
+				return nil
+			})
+			return step, err
+		})
+		result, err := c.await(stepID)
+		if err != nil {
+			return err
+		}
+		switch value := result.(type) {
+		case backupStep:
+			if progress != nil {
+				progress(value.remaining, value.total)
+			}
+			if value.done {
+				return nil
+			}
+		case error:
+			return fmt.Errorf("failed to backup to %q: %w", destPath, value)
+		default:
+			return fmt.Errorf("unexpected type")
+		}
+	}
+}
+
+// Replace the database with the one at srcPath with the backup API of mattn/go-sqlite3, in a single job.
+func (c *ComfyDB) restore(ctx context.Context, srcPath string) error {
+	if !c.mattn() {
+		return fmt.Errorf("%w: restore requires the sqlite3 driver", ErrUnsupported)
+	}
+	src, err := (&sqlite3.SQLiteDriver{}).Open(fmt.Sprintf("file:%s?mode=ro", srcPath))
+	if err != nil {
+		return fmt.Errorf("failed to open restore source %q: %w", srcPath, err)
+	}
+	defer src.Close()
+	srcConn := src.(*sqlite3.SQLiteConn)
+
+	restoreID := c.newContext(ctx, func(_ context.Context, db *sql.DB) (interface{}, error) {
+		return nil, withRawConn(db, func(conn *rawConn) error {
+			backup, err := conn.Backup("main", srcConn, "main")
+			if err != nil {
+				return err
+			}
+			done, err := backup.Step(-1)
+			if errFinish := backup.Finish(); err == nil {
+				err = errFinish
+			}
+			if err == nil && !done {
+				err = fmt.Errorf("database is busy")
+			}
+			return err
+		})
+	})
+	result, err := c.await(restoreID)
+	if err != nil {
+		return err
+	}
+	if errResult, ok := result.(error); ok {
+		return fmt.Errorf("failed to restore from %q: %w", srcPath, errResult)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package comfylite3
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	setupID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		if _, err := db.Exec("CREATE TABLE IF NOT EXISTS backup_pets (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec("DELETE FROM backup_pets"); err != nil {
+			return nil, err
+		}
+		return db.Exec("INSERT INTO backup_pets (name) VALUES ('rex'), ('felix')")
+	})
+	if _, err := comfyMe.Result(setupID); err != nil {
+		t.Fatal(err)
+	}
+
+	path := t.TempDir() + "/backup.db"
+	steps := 0
+	err = comfyMe.BackupWithProgress(path, func(remaining, total int) {
+		steps++
+		if remaining > total {
+			t.Errorf("expected remaining %d to be at most total %d", remaining, total)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps == 0 {
+		t.Fatal("expected progress to be reported")
+	}
+
+	backup, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	var count int
+	if err := backup.QueryRow("SELECT COUNT(*) FROM backup_pets").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 rows in the backup, got %d", count)
+	}
+
+	restored, err := New(WithPath(t.TempDir() + "/restored.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if err := restored.Restore(path); err != nil {
+		t.Fatal(err)
+	}
+	countID := restored.New(func(db *sql.DB) (interface{}, error) {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM backup_pets").Scan(&count)
+		return count, err
+	})
+	if value, err := restored.Result(countID); err != nil || value != 2 {
+		t.Fatalf("expected 2 restored rows, got %v %v", value, err)
+	}
+}
+
+func TestBackupTo(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/live.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if err := comfyMe.ExecScript("CREATE TABLE pets (name TEXT); INSERT INTO pets VALUES ('rex'), ('felix');"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := t.TempDir() + "/backup.db"
+	if err := comfyMe.BackupTo(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := comfyMe.BackupToWriter(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	written := t.TempDir() + "/written.db"
+	if err := os.WriteFile(written, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, backupPath := range []string{path, written} {
+		backup, err := sql.Open("sqlite3", backupPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		err = backup.QueryRow("SELECT COUNT(*) FROM pets").Scan(&count)
+		backup.Close()
+		if err != nil || count != 2 {
+			t.Fatalf("expected 2 rows in %s, got %d %v", backupPath, count, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := comfyMe.BackupTo(ctx, t.TempDir()+"/cancelled.db"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if err := comfyMe.BackupToWriter(ctx, &buf); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRestoreFrom(t *testing.T) {
+	source, err := New(WithPath(t.TempDir() + "/source.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	if err := source.ExecScript("CREATE TABLE pets (name TEXT); INSERT INTO pets VALUES ('rex'), ('felix');"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := source.BackupToWriter(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := New(WithPath(t.TempDir() + "/restored.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := restored.RestoreFrom(ctx, bytes.NewReader(buf.Bytes())); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if err := restored.RestoreFrom(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := restored.QueryRow("SELECT COUNT(*) FROM pets").Scan(&count); err != nil || count != 2 {
+		t.Fatalf("expected 2 restored rows, got %d %v", count, err)
+	}
+	if err := restored.RestoreFrom(context.Background(), bytes.NewReader([]byte("not a database"))); err == nil {
+		t.Fatal("expected an error restoring garbage")
+	}
+}
+
+func TestPersist(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if err := comfyMe.ExecScript("CREATE TABLE IF NOT EXISTS persisted (name TEXT); DELETE FROM persisted; INSERT INTO persisted VALUES ('rex');"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := t.TempDir() + "/persisted.db"
+	if err := comfyMe.Persist(path); err != nil {
+		t.Fatal(err)
+	}
+	// replaces the previous snapshot
+	if err := comfyMe.ExecScript("INSERT INTO persisted VALUES ('felix');"); err != nil {
+		t.Fatal(err)
+	}
+	if err := comfyMe.Persist(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("expected the temporary file to be gone, got %v", err)
+	}
+
+	reopened, err := New(WithPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	var count int
+	if err := reopened.QueryRow("SELECT COUNT(*) FROM persisted").Scan(&count); err != nil || count != 2 {
+		t.Fatalf("expected 2 persisted rows, got %d %v", count, err)
+	}
+
+	if err := comfyMe.Persist(t.TempDir() + "/missing/persisted.db"); err == nil {
+		t.Fatal("expected an error persisting to a missing directory")
+	}
+}
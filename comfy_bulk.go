@@ -0,0 +1,147 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Host parameters of a multi-value INSERT of InsertMany, the historical maximum of SQLite.
+const maxInsertVariables = 999
+
+// BulkInsert executes query once per row of arguments in a single job and a single transaction,
+// preparing the statement once, and returns the total of rows affected.
+// Rows are executed in batches of batchSize (all at once if zero or less), the job's deadline being checked between two batches.
+// Any failure rolls back every row.
+func (c *ComfyDB) BulkInsert(query string, rows [][]interface{}, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = len(rows)
+	}
+	// the job gets the default timeout of WithJobTimeout
+	bulkID := c.NewWithTimeout(c.jobTimeout, func(ctx context.Context, db *sql.DB) (interface{}, error) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer stmt.Close()
+
+		var total int64
+		for start := 0; start < len(rows); start += batchSize {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			end := min(start+batchSize, len(rows))
+			for i := start; i < end; i++ {
+				result, err := stmt.ExecContext(ctx, rows[i]...)
+				if err != nil {
+					return nil, fmt.Errorf("failed to insert row %d: %w", i, err)
+				}
+				affected, err := result.RowsAffected()
+				if err != nil {
+					return nil, err
+				}
+				total += affected
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return total, nil
+	})
+	result, err := c.awaitResult(context.Background(), bulkID)
+	if err != nil {
+		return 0, err
+	}
+	total, ok := result.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected type")
+	}
+	return total, nil
+}
+
+// InsertMany inserts rows into the columns of table with multi-value INSERT statements, as many rows per statement
+// as SQLite's 999 parameters allow, in a single job and a single transaction, and returns the number of rows inserted.
+// Each row holds a value per column. Any failure rolls back every row.
+func (c *ComfyDB) InsertMany(table string, columns []string, rows [][]interface{}) (int64, error) {
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("no columns to insert into %q", table)
+	}
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return 0, fmt.Errorf("row %d has %d values for %d columns", i, len(row), len(columns))
+		}
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdentifier(column)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quoteIdentifier(table), strings.Join(quoted, ", "))
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	chunk := max(maxInsertVariables/len(columns), 1)
+
+	insertID := c.NewWithTimeout(c.jobTimeout, func(ctx context.Context, db *sql.DB) (interface{}, error) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		var total int64
+		var stmt *sql.Stmt // of the full chunks, only the last one is shorter
+		defer func() {
+			if stmt != nil {
+				stmt.Close()
+			}
+		}()
+		args := make([]interface{}, 0, chunk*len(columns))
+		for start := 0; start < len(rows); start += chunk {
+			end := min(start+chunk, len(rows))
+			args = args[:0]
+			for _, row := range rows[start:end] {
+				args = append(args, row...)
+			}
+			var result sql.Result
+			if end-start == chunk {
+				if stmt == nil {
+					query := prefix + strings.TrimSuffix(strings.Repeat(tuple+", ", chunk), ", ")
+					c.echoQuery(query, nil)
+					if stmt, err = tx.PrepareContext(ctx, query); err != nil {
+						return nil, err
+					}
+				}
+				result, err = stmt.ExecContext(ctx, args...)
+			} else {
+				query := prefix + strings.TrimSuffix(strings.Repeat(tuple+", ", end-start), ", ")
+				c.echoQuery(query, nil)
+				result, err = tx.ExecContext(ctx, query, args...)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert rows %d to %d: %w", start, end-1, err)
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return nil, err
+			}
+			total += affected
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return total, nil
+	})
+	result, err := c.awaitResult(context.Background(), insertID)
+	if err != nil {
+		return 0, err
+	}
+	total, ok := result.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected type")
+	}
+	return total, nil
+}
@@ -0,0 +1,89 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestBulkInsert(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	setupID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		if _, err := db.Exec("CREATE TABLE IF NOT EXISTS bulk_users (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+			return nil, err
+		}
+		return db.Exec("DELETE FROM bulk_users")
+	})
+	if _, err := comfyMe.Result(setupID); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := make([][]interface{}, 10000)
+	for i := range rows {
+		rows[i] = []interface{}{i + 1, "user"}
+	}
+	total, err := comfyMe.BulkInsert("INSERT INTO bulk_users (id, name) VALUES (?, ?)", rows, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 10000 {
+		t.Fatalf("expected 10000 rows affected, got %d", total)
+	}
+
+	// the duplicate of id 1 fails the whole bulk
+	failing := [][]interface{}{{10001, "new"}, {1, "duplicate"}}
+	if _, err := comfyMe.BulkInsert("INSERT INTO bulk_users (id, name) VALUES (?, ?)", failing, 1); err == nil {
+		t.Fatal("expected the duplicate to fail")
+	}
+	var count int
+	if err := comfyMe.QueryRow("SELECT COUNT(*) FROM bulk_users").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 10000 {
+		t.Fatalf("expected the failed bulk to be rolled back, got %d rows", count)
+	}
+}
+
+func TestInsertMany(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/many.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if _, err := comfyMe.Exec("CREATE TABLE many_users (id INTEGER PRIMARY KEY, name TEXT, \"group\" TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 333 rows per statement, a shorter one for the rest
+	rows := make([][]interface{}, 1000)
+	for i := range rows {
+		rows[i] = []interface{}{i + 1, "user", "g"}
+	}
+	total, err := comfyMe.InsertMany("many_users", []string{"id", "name", "group"}, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1000 {
+		t.Fatalf("expected 1000 rows inserted, got %d", total)
+	}
+
+	failing := [][]interface{}{{1001, "new", "g"}, {1, "duplicate", "g"}}
+	if _, err := comfyMe.InsertMany("many_users", []string{"id", "name", "group"}, failing); err == nil {
+		t.Fatal("expected the duplicate to fail")
+	}
+	var count int
+	if err := comfyMe.QueryRow("SELECT COUNT(*) FROM many_users").Scan(&count); err != nil || count != 1000 {
+		t.Fatalf("expected the failed insert to be rolled back, got %d rows %v", count, err)
+	}
+
+	if _, err := comfyMe.InsertMany("many_users", []string{"id", "name"}, [][]interface{}{{1}}); err == nil {
+		t.Fatal("expected an error for a row missing values")
+	}
+	if _, err := comfyMe.InsertMany("many_users", nil, nil); err == nil {
+		t.Fatal("expected an error without columns")
+	}
+}
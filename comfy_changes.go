@@ -0,0 +1,47 @@
+package comfylite3
+
+// ChangeOp is the kind of row change reported to OnChange.
+type ChangeOp int
+
+// The values of SQLITE_INSERT, SQLITE_UPDATE and SQLITE_DELETE.
+const (
+	ChangeInsert ChangeOp = 18
+	ChangeUpdate ChangeOp = 23
+	ChangeDelete ChangeOp = 9
+)
+
+func (op ChangeOp) String() string {
+	switch op {
+	case ChangeInsert:
+		return "INSERT"
+	case ChangeUpdate:
+		return "UPDATE"
+	case ChangeDelete:
+		return "DELETE"
+	}
+	return "UNKNOWN"
+}
+
+// OnChange registers fn to be called for every row inserted, updated or deleted through the worker connection,
+// from SQLite's update hook. The functions run in the order they were registered.
+//
+// fn runs inside SQLite, on the worker, in the middle of the statement making the change:
+// it must be fast and must not use the database nor submit a job and wait for it (it would wait for itself).
+// Send the change to a buffered channel you drain elsewhere. The change may still be rolled back, see OnRollback.
+// Only rowid tables are reported, and neither the rows replaced by ON CONFLICT REPLACE
+// nor those of a DELETE without WHERE, which SQLite truncates. Requires the sqlite3 driver.
+func (c *ComfyDB) OnChange(fn func(op ChangeOp, table string, rowid int64)) {
+	c.txHooksMu.Lock()
+	defer c.txHooksMu.Unlock()
+	c.onChange = append(c.onChange, fn)
+}
+
+// Call the OnChange functions from the update hook.
+func (c *ComfyDB) fireChange(op int, table string, rowid int64) {
+	c.txHooksMu.RLock()
+	onChange := c.onChange
+	c.txHooksMu.RUnlock()
+	for _, fn := range onChange {
+		c.callHook(func() { fn(ChangeOp(op), table, rowid) })
+	}
+}
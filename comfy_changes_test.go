@@ -0,0 +1,47 @@
+package comfylite3
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestOnChange(t *testing.T) {
+	comfyMe, err := New(WithPath(filepath.Join(t.TempDir(), "changes.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	changes := make(chan string, 16)
+	comfyMe.OnChange(func(op ChangeOp, table string, rowid int64) {
+		changes <- fmt.Sprintf("%s %s %d", op, table, rowid)
+	})
+
+	if _, err := comfyMe.Exec("CREATE TABLE pets (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO pets (name) VALUES ('rex'), ('felix')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("UPDATE pets SET name = 'max' WHERE rowid = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("DELETE FROM pets WHERE rowid = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"INSERT pets 1", "INSERT pets 2", "UPDATE pets 2", "DELETE pets 1"} {
+		select {
+		case change := <-changes:
+			if change != expected {
+				t.Fatalf("expected %q, got %q", expected, change)
+			}
+		default:
+			t.Fatalf("expected %q before the statement returned", expected)
+		}
+	}
+	if len(changes) != 0 {
+		t.Fatalf("unexpected change %q", <-changes)
+	}
+}
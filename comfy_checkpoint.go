@@ -0,0 +1,70 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Outcome of a WAL checkpoint, the row of `PRAGMA wal_checkpoint`.
+type CheckpointResult struct {
+	Busy         bool // the checkpoint couldn't complete, blocked by a reader or writer of another connection
+	Log          int  // frames in the WAL, -1 when the database is not in WAL mode
+	Checkpointed int  // frames of the WAL copied into the database file
+}
+
+// Modes of `PRAGMA wal_checkpoint`.
+var checkpointModes = map[string]bool{"PASSIVE": true, "FULL": true, "RESTART": true, "TRUNCATE": true}
+
+// Checkpoint copies the WAL into the database file with `PRAGMA wal_checkpoint(mode)`: "PASSIVE", "FULL", "RESTART"
+// or "TRUNCATE". It runs as a worker job, so the worker's own writes never block it.
+// SQLite checkpoints on its own once the WAL holds 1000 pages, call it to do it sooner or to shrink the WAL with TRUNCATE.
+func (c *ComfyDB) Checkpoint(mode string) (CheckpointResult, error) {
+	mode = strings.ToUpper(mode)
+	if !checkpointModes[mode] {
+		return CheckpointResult{}, fmt.Errorf("invalid checkpoint mode %q", mode)
+	}
+	query := fmt.Sprintf("PRAGMA wal_checkpoint(%s)", mode)
+	checkpointID := c.New(func(db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, nil)
+		var result CheckpointResult
+		err := db.QueryRow(query).Scan(&result.Busy, &result.Log, &result.Checkpointed)
+		return result, err
+	})
+	result, err := c.awaitResult(context.Background(), checkpointID)
+	if err != nil {
+		return CheckpointResult{}, fmt.Errorf("failed to checkpoint: %w", err)
+	}
+	value, ok := result.(CheckpointResult)
+	if !ok {
+		return CheckpointResult{}, fmt.Errorf("unexpected type")
+	}
+	return value, nil
+}
+
+// WithCheckpointInterval runs Checkpoint(mode) every d while the worker runs, typically TRUNCATE to keep the WAL small.
+// A failed checkpoint is logged as a warning to the logger of WithSlog, the next one is tried all the same. See WithWAL.
+func WithCheckpointInterval(d time.Duration, mode string) ComfyOption {
+	return func(c *ComfyDB) {
+		c.checkpointInterval = d
+		c.checkpointMode = strings.ToUpper(mode)
+	}
+}
+
+// Checkpoint every interval until the worker stops.
+func (c *ComfyDB) checkpointEvery(stopped <-chan struct{}) {
+	ticker := time.NewTicker(c.checkpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+		if _, err := c.Checkpoint(c.checkpointMode); err != nil {
+			c.warnings().Warn("comfylite3: checkpoint failed", "mode", c.checkpointMode, "error", err)
+		}
+	}
+}
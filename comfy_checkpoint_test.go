@@ -0,0 +1,64 @@
+package comfylite3
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := t.TempDir() + "/checkpoint.db"
+	comfyMe, err := New(WithPath(path), WithWAL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if err := comfyMe.ExecScript("CREATE TABLE pets (name TEXT); INSERT INTO pets VALUES ('rex'), ('felix');"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := comfyMe.Checkpoint("passive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Busy || result.Log == 0 || result.Checkpointed != result.Log {
+		t.Fatalf("expected the whole WAL to be checkpointed, got %+v", result)
+	}
+	if _, err := comfyMe.Checkpoint("TRUNCATE"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path + "-wal"); err != nil || info.Size() != 0 {
+		t.Fatalf("expected the WAL to be truncated, got %v %v", info, err)
+	}
+	if _, err := comfyMe.Checkpoint("sometimes"); err == nil {
+		t.Fatal("expected an error for an invalid checkpoint mode")
+	}
+}
+
+func TestCheckpointInterval(t *testing.T) {
+	path := t.TempDir() + "/checkpoint.db"
+	comfyMe, err := New(WithPath(path), WithWAL(), WithCheckpointInterval(10*time.Millisecond, "TRUNCATE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if err := comfyMe.ExecScript("CREATE TABLE pets (name TEXT); INSERT INTO pets VALUES ('rex'), ('felix');"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, err := os.Stat(path + "-wal")
+		if err == nil && info.Size() == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the WAL to be truncated in the background, got %v %v", info, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := New(WithMemory(), WithCheckpointInterval(time.Second, "sometimes")); err == nil {
+		t.Fatal("expected an error for an invalid checkpoint mode")
+	}
+}
@@ -0,0 +1,91 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Do runs fn on the worker, waits for it and returns its typed result: no type assertion on your side.
+func Do[T any](c *ComfyDB, fn func(db *sql.DB) (T, error)) (T, error) {
+	workID := c.New(func(db *sql.DB) (interface{}, error) {
+		return fn(db)
+	})
+	return typedResult[T](context.Background(), c, workID)
+}
+
+// DoContext is Do bound to ctx like NewContext: fn is dropped if ctx is done before it runs,
+// and it receives the context of its job to use in its queries. Once ctx is done it returns ctx.Err(), fn goes on.
+func DoContext[T any](ctx context.Context, c *ComfyDB, fn func(ctx context.Context, db *sql.DB) (T, error)) (T, error) {
+	workID := c.newContext(ctx, func(jobCtx context.Context, db *sql.DB) (interface{}, error) {
+		return fn(jobCtx, db)
+	})
+	return typedResult[T](ctx, c, workID)
+}
+
+// Do is the untyped Do function: it submits fn bound to ctx like NewContext and waits for its result,
+// as long as fn runs or until ctx is done.
+func (c *ComfyDB) Do(ctx context.Context, fn SqlFn) (interface{}, error) {
+	workID := c.NewContext(ctx, fn)
+	return c.awaitResult(ctx, workID)
+}
+
+// Future is the typed ticket of a job submitted by Submit.
+type Future[T any] struct {
+	item *workItem
+}
+
+// Submit adds fn to the queue like New and returns its Future rather than a workID.
+// The result belongs to the Future: it's not kept for WaitFor and goes away with the Future.
+func Submit[T any](c *ComfyDB, fn func(db *sql.DB) (T, error)) *Future[T] {
+	item := c.newWorkItem(withoutContext(func(db *sql.DB) (interface{}, error) {
+		return fn(db)
+	}))
+	c.dispatch(item)
+	return &Future[T]{item: item}
+}
+
+// ID of the job, for NewAfter or Cancel.
+func (f *Future[T]) ID() uint64 {
+	return f.item.id
+}
+
+// Result waits for the job until ctx is done and returns its typed result, as many times as needed.
+// Once ctx is done it returns ctx.Err(), the job goes on.
+func (f *Future[T]) Result(ctx context.Context) (T, error) {
+	select {
+	case <-f.item.done:
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+	if f.item.err != nil {
+		var zero T
+		return zero, f.item.err
+	}
+	return typed[T](f.item.value)
+}
+
+// Wait for a job submitted by Do or DoContext, as long as it runs or until ctx is done.
+func typedResult[T any](ctx context.Context, c *ComfyDB, workID uint64) (T, error) {
+	value, err := c.awaitResult(ctx, workID)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return typed[T](value)
+}
+
+// The result of a job as a T.
+func typed[T any](value interface{}) (T, error) {
+	var zero T
+	// a nil interface or pointer comes back untyped
+	if value == nil {
+		return zero, nil
+	}
+	result, ok := value.(T)
+	if !ok {
+		return zero, fmt.Errorf("unexpected type %T", value)
+	}
+	return result, nil
+}
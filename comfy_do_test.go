@@ -0,0 +1,138 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestDo(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	count, err := Do(comfyMe, func(db *sql.DB) (int, error) {
+		var count int
+		err := db.QueryRow("SELECT 40 + 2").Scan(&count)
+		return count, err
+	})
+	if err != nil || count != 42 {
+		t.Fatalf("expected 42, got %v %v", count, err)
+	}
+
+	failure := errors.New("failure")
+	if _, err := Do(comfyMe, func(db *sql.DB) (int, error) {
+		return 0, failure
+	}); !errors.Is(err, failure) {
+		t.Fatalf("expected the error of the function, got %v", err)
+	}
+
+	if result, err := Do(comfyMe, func(db *sql.DB) (sql.Result, error) {
+		return nil, nil
+	}); err != nil || result != nil {
+		t.Fatalf("expected a nil result, got %v %v", result, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := DoContext(ctx, comfyMe, func(ctx context.Context, db *sql.DB) (string, error) {
+		return "too late", nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// done while fn runs: DoContext returns right away, fn goes on
+	running, cancelRunning := context.WithCancel(context.Background())
+	started, release := make(chan struct{}), make(chan struct{})
+	go func() {
+		<-started
+		cancelRunning()
+	}()
+	if _, err := DoContext(running, comfyMe, func(ctx context.Context, db *sql.DB) (string, error) {
+		close(started)
+		<-release
+		return "released", nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	close(release)
+}
+
+func TestDoMethod(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	ctx := context.Background()
+	value, err := comfyMe.Do(ctx, func(db *sql.DB) (interface{}, error) {
+		var n int
+		err := db.QueryRow("SELECT 40 + 2").Scan(&n)
+		return n, err
+	})
+	if err != nil || value != 42 {
+		t.Fatalf("expected 42, got %v %v", value, err)
+	}
+	if _, err := comfyMe.Do(ctx, func(db *sql.DB) (interface{}, error) {
+		return db.Exec("SELECT missing")
+	}); err == nil {
+		t.Fatal("expected the error of the job")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := comfyMe.Do(cancelled, func(db *sql.DB) (interface{}, error) {
+		return "too late", nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	release := make(chan struct{})
+	blocked := Submit(comfyMe, func(db *sql.DB) (string, error) {
+		<-release
+		return "released", nil
+	})
+	count := Submit(comfyMe, func(db *sql.DB) (int, error) {
+		var count int
+		err := db.QueryRow("SELECT 40 + 2").Scan(&count)
+		return count, err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := blocked.Result(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected to stop waiting with the context, got %v", err)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if value, err := blocked.Result(context.Background()); err != nil || value != "released" {
+			t.Fatalf("expected the result of the job, got %v %v", value, err)
+		}
+	}
+	if value, err := count.Result(context.Background()); err != nil || value != 42 {
+		t.Fatalf("expected 42, got %v %v", value, err)
+	}
+	if _, err := comfyMe.WaitFor(count.ID()); err == nil {
+		t.Fatal("expected the result to belong to the future")
+	}
+
+	failure := errors.New("failure")
+	failed := Submit(comfyMe, func(db *sql.DB) (int, error) {
+		return 0, failure
+	})
+	if _, err := failed.Result(context.Background()); !errors.Is(err, failure) {
+		t.Fatalf("expected the error of the function, got %v", err)
+	}
+}
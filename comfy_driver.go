@@ -4,17 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"io"
+	"reflect"
 	"strings"
+	"time"
 )
 
 type ComfyDriver struct {
 	comfy   *ComfyDB
 	connStr string
+	err     error // returned by every Open when OpenDB got conflicting options
 }
 
 func (cd *ComfyDriver) Open(name string) (driver.Conn, error) {
+	if cd.err != nil {
+		return nil, cd.err
+	}
 	return &comfyConn{comfy: cd.comfy, connStr: cd.connStr}, nil
 }
 
@@ -29,22 +36,178 @@ func (cd *ComfyDriver) Driver() driver.Driver {
 type comfyConn struct {
 	comfy   *ComfyDB
 	connStr string
+
+	// transaction in progress on this connection, its statements are routed to it
+	tx *comfyTx
 }
 
 func (cc *comfyConn) Prepare(query string) (driver.Stmt, error) {
-	return &comfyStmt{comfy: cc.comfy, query: query}, nil
+	return &comfyStmt{comfy: cc.comfy, conn: cc, query: query}, nil
 }
 
 func (cc *comfyConn) Close() error {
 	return nil
 }
 
+// Ping probes the worker, see ComfyDB.PingContext.
+func (cc *comfyConn) Ping(ctx context.Context) error {
+	return cc.comfy.PingContext(ctx)
+}
+
+// CheckNamedValue accepts every argument as is: the worker's sql.DB converts them, names included, when running the query.
+func (cc *comfyConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return nil
+}
+
 func (cc *comfyConn) Begin() (driver.Tx, error) {
-	return &comfyTx{comfy: cc.comfy}, nil
+	return cc.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx starts a real SQLite transaction: the worker is dedicated to it until it commits or rolls back.
+// Other jobs wait in the queue meanwhile, so they never interleave with the transaction.
+// Beginning again while a transaction is in progress on the connection opens a savepoint inside it.
+func (cc *comfyConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if tx := cc.tx; tx != nil {
+		return tx.savepoint()
+	}
+	tx := &comfyTx{
+		comfy: cc.comfy,
+		conn:  cc,
+		opts: &sql.TxOptions{
+			Isolation: sql.IsolationLevel(opts.Isolation),
+			ReadOnly:  opts.ReadOnly,
+		},
+		begun:     make(chan error, 1),
+		requests:  make(chan *txRequest),
+		finished:  make(chan struct{}),
+		abandoned: make(chan struct{}),
+	}
+	// the transaction lasts as long as it's used, WithTxTimeout handles abandoned ones
+	item := cc.comfy.newWorkItem(withoutContext(tx.serve))
+	item.timeout = 0
+	tx.id = item.id
+	cc.comfy.dispatch(item)
+
+	select {
+	case err := <-tx.begun:
+		if err != nil {
+			return nil, err
+		}
+	case <-item.done:
+		// abandoned by CloseContext, or already rolled back because the database is closing
+		if item.err != nil {
+			return nil, item.err
+		}
+		return nil, tx.err
+	case <-ctx.Done():
+		close(tx.abandoned)
+		return nil, ctx.Err()
+	}
+
+	cc.tx = tx
+	return tx, nil
+}
+
+// ExecContext executes a query on the worker without the prepare/exec/close round-trip.
+// A query still queued when ctx is done is dropped, a running one is interrupted by SQLite.
+func (cc *comfyConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return cc.exec(ctx, query, convertNamedValues(args))
+}
+
+// QueryContext queries on the worker without the prepare/query/close round-trip.
+// A query still queued when ctx is done is dropped, a running one is interrupted by SQLite.
+func (cc *comfyConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return cc.query(ctx, query, convertNamedValues(args))
+}
+
+func (cc *comfyConn) exec(ctx context.Context, query string, args []interface{}) (driver.Result, error) {
+	if err := cc.comfy.checkWritable(query); err != nil {
+		return nil, err
+	}
+	if tx := cc.tx; tx != nil {
+		result, err := tx.do(ctx, query, args, func(sqlTx *sql.Tx) (interface{}, error) {
+			cc.comfy.echoQuery(query, args)
+			return captureResult(tx.execCached(ctx, sqlTx, query, args))
+		})
+		if err != nil {
+			return nil, wrapQueryError(tx.id, query, args, err)
+		}
+		return result.(*comfyResult), nil
+	}
+	id := cc.comfy.newQuery(ctx, query, args, func(jobCtx context.Context, db *sql.DB) (interface{}, error) {
+		cc.comfy.echoQuery(query, args)
+		return captureResult(cc.comfy.execCached(jobCtx, db, query, args))
+	})
+	result := cc.comfy.awaitOutcome(id)
+	if err, ok := result.(error); ok {
+		return nil, wrapQueryError(id, query, args, err)
+	}
+	return result.(*comfyResult), nil
+}
+
+// Result of an Exec, read on the worker right after it ran.
+// Reading a sql.Result later would wait for the worker's connection, busy with the next jobs.
+type comfyResult struct {
+	lastInsertID    int64
+	lastInsertIDErr error
+	rowsAffected    int64
+	rowsAffectedErr error
+}
+
+func captureResult(result sql.Result, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	captured := &comfyResult{}
+	captured.lastInsertID, captured.lastInsertIDErr = result.LastInsertId()
+	captured.rowsAffected, captured.rowsAffectedErr = result.RowsAffected()
+	return captured, nil
+}
+
+func (cr *comfyResult) LastInsertId() (int64, error) {
+	return cr.lastInsertID, cr.lastInsertIDErr
+}
+
+func (cr *comfyResult) RowsAffected() (int64, error) {
+	return cr.rowsAffected, cr.rowsAffectedErr
+}
+
+func (cc *comfyConn) query(ctx context.Context, query string, args []interface{}) (driver.Rows, error) {
+	if err := cc.comfy.checkWritable(query); err != nil {
+		return nil, err
+	}
+	if tx := cc.tx; tx != nil {
+		result, err := tx.do(ctx, query, args, func(sqlTx *sql.Tx) (interface{}, error) {
+			cc.comfy.echoQuery(query, args)
+			rows, err := tx.queryCached(ctx, sqlTx, query, args)
+			if err != nil {
+				return nil, err
+			}
+			return snapshotRows(rows)
+		})
+		if err != nil {
+			return nil, wrapQueryError(tx.id, query, args, err)
+		}
+		return result.(*comfyRows), nil
+	}
+	id := cc.comfy.newQuery(ctx, query, args, func(jobCtx context.Context, db *sql.DB) (interface{}, error) {
+		cc.comfy.echoQuery(query, args)
+		rows, err := cc.comfy.queryCached(jobCtx, db, query, args)
+		if err != nil {
+			return nil, err
+		}
+		return snapshotRows(rows)
+	})
+	result := cc.comfy.awaitOutcome(id)
+	if err, ok := result.(error); ok {
+		return nil, wrapQueryError(id, query, args, err)
+	}
+	return result.(*comfyRows), nil
 }
 
 type comfyStmt struct {
 	comfy *ComfyDB
+	conn  *comfyConn
 	query string
 }
 
@@ -52,87 +215,327 @@ func (cs *comfyStmt) Close() error {
 	return nil
 }
 
+// NumInput counts the `?` placeholders of the query so database/sql checks the number of arguments.
+// Queries with named or numbered placeholders return -1, the arguments are checked by SQLite.
 func (cs *comfyStmt) NumInput() int {
-	return -1
+	return countPlaceholders(cs.query)
 }
 
 func (cs *comfyStmt) Exec(args []driver.Value) (driver.Result, error) {
-	id := cs.comfy.New(func(db *sql.DB) (interface{}, error) {
-		return db.Exec(cs.query, convertValues(args)...)
-	})
-	result := <-cs.comfy.WaitForChn(id)
-	if err, ok := result.(error); ok {
-		return nil, err
-	}
-	return result.(sql.Result), nil
+	return cs.conn.exec(context.Background(), cs.query, convertValues(args))
 }
 
 func (cs *comfyStmt) Query(args []driver.Value) (driver.Rows, error) {
-	id := cs.comfy.New(func(db *sql.DB) (interface{}, error) {
-		return db.Query(cs.query, convertValues(args)...)
-	})
-	result := <-cs.comfy.WaitForChn(id)
-	if err, ok := result.(error); ok {
-		return nil, err
-	}
-	return &comfyRows{rows: result.(*sql.Rows)}, nil
+	return cs.conn.query(context.Background(), cs.query, convertValues(args))
 }
 
+// ExecContext executes the statement with its named arguments, see comfyConn.ExecContext.
+func (cs *comfyStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return cs.conn.exec(ctx, cs.query, convertNamedValues(args))
+}
+
+// QueryContext queries with the statement's named arguments, see comfyConn.QueryContext.
+func (cs *comfyStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return cs.conn.query(ctx, cs.query, convertNamedValues(args))
+}
+
+// Result set of a query, read whole on the worker: iterating it doesn't touch the worker's connection,
+// busy with the next jobs by then. DB.Query of OpenDB therefore holds every row in memory,
+// use Stream for the large ones.
 type comfyRows struct {
-	rows *sql.Rows
+	columns []string
+	types   []columnMeta
+	values  [][]driver.Value
+	next    int // index of the next row
+}
+
+// Column type metadata of the rows, read along with them.
+type columnMeta struct {
+	scanType         reflect.Type
+	databaseTypeName string
+	nullable         bool
+	nullableOK       bool
+}
+
+// Read rows to the end and close them, on the worker.
+func snapshotRows(rows *sql.Rows) (*comfyRows, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	cr := &comfyRows{columns: columns, values: [][]driver.Value{}}
+	if types, err := rows.ColumnTypes(); err == nil {
+		cr.types = make([]columnMeta, len(types))
+		for i, ct := range types {
+			cr.types[i].scanType = ct.ScanType()
+			cr.types[i].databaseTypeName = ct.DatabaseTypeName()
+			cr.types[i].nullable, cr.types[i].nullableOK = ct.Nullable()
+		}
+	}
+
+	// Prepare a slice of pointers to empty interfaces to pass to rows.Scan, []byte values are copies
+	dest := make([]interface{}, len(columns))
+	for rows.Next() {
+		row := make([]interface{}, len(columns))
+		for i := range dest {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			values[i] = driver.Value(v)
+		}
+		cr.values = append(cr.values, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return cr, nil
 }
 
 func (cr *comfyRows) Columns() []string {
-	cols, _ := cr.rows.Columns()
-	return cols
+	return cr.columns
+}
+
+// Column type metadata of the rows, nil if unavailable.
+func (cr *comfyRows) columnType(index int) *columnMeta {
+	if index < 0 || index >= len(cr.types) {
+		return nil
+	}
+	return &cr.types[index]
+}
+
+func (cr *comfyRows) ColumnTypeScanType(index int) reflect.Type {
+	if ct := cr.columnType(index); ct != nil && ct.scanType != nil {
+		return ct.scanType
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (cr *comfyRows) ColumnTypeDatabaseTypeName(index int) string {
+	if ct := cr.columnType(index); ct != nil {
+		return ct.databaseTypeName
+	}
+	return ""
+}
+
+func (cr *comfyRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if ct := cr.columnType(index); ct != nil {
+		return ct.nullable, ct.nullableOK
+	}
+	return false, false
 }
 
 func (cr *comfyRows) Close() error {
-	return cr.rows.Close()
+	cr.values = nil
+	return nil
 }
 
 func (cr *comfyRows) Next(dest []driver.Value) error {
-	if !cr.rows.Next() {
+	if cr.next >= len(cr.values) {
 		return io.EOF
 	}
+	row := cr.values[cr.next]
+	cr.next++
 
-	columns, err := cr.rows.Columns()
-	if err != nil {
-		return err
+	if len(dest) != len(row) {
+		return fmt.Errorf("expected %d columns but got %d", len(dest), len(row))
 	}
+	copy(dest, row)
+	return nil
+}
 
-	if len(dest) != len(columns) {
-		return fmt.Errorf("expected %d columns but got %d", len(dest), len(columns))
-	}
+// ErrTxAbandoned is returned when a transaction was rolled back because it stayed idle longer than WithTxTimeout.
+var ErrTxAbandoned = errors.New("transaction abandoned")
+
+type comfyTx struct {
+	comfy *ComfyDB
+	conn  *comfyConn
+	opts  *sql.TxOptions
+	id    uint64               // ticket of the job serving the transaction
+	depth int                  // savepoints opened by nested BeginTx
+	stmts map[string]*sql.Stmt // statements of the transaction with WithStmtCache, used on the worker only
+
+	begun     chan error      // result of BEGIN
+	requests  chan *txRequest // statements to run in the transaction
+	finished  chan struct{}   // closed when the worker leaves the transaction
+	abandoned chan struct{}   // closed when nobody waits for BEGIN anymore
+
+	err error // why the worker left the transaction, set before finished is closed
+}
 
-	// Prepare a slice of pointers to empty interfaces to pass to rows.Scan
-	values := make([]interface{}, len(dest))
-	for i := range values {
-		values[i] = new(interface{})
+// A statement to run inside the transaction on the worker.
+type txRequest struct {
+	fn    func(tx *sql.Tx) (interface{}, error)
+	end   bool // commit or rollback, the worker leaves the transaction afterwards
+	done  chan struct{}
+	query string // for WithLogger
+	args  int
+	ctx   context.Context // of the caller, for WithTracing
+	sent  time.Time
+
+	value interface{}
+	err   error
+}
+
+// Job holding the worker for the whole life of the transaction.
+func (ct *comfyTx) serve(db *sql.DB) (interface{}, error) {
+	defer close(ct.finished)
+
+	select {
+	case <-ct.abandoned:
+		ct.err = sql.ErrTxDone
+		return nil, nil
+	default:
 	}
 
-	if err := cr.rows.Scan(values...); err != nil {
-		return err
+	tx, err := db.BeginTx(context.Background(), ct.opts)
+	if err == nil {
+		ct.comfy.openTxs.Add(1)
+		defer ct.comfy.openTxs.Add(-1)
+	}
+	if err == nil && ct.opts.ReadOnly && !ct.comfy.readOnly {
+		// the sqlite3 driver ignores TxOptions.ReadOnly, the connection refuses the writes until the transaction ends
+		if _, err = tx.Exec("PRAGMA query_only=ON"); err != nil {
+			tx.Rollback()
+		} else {
+			defer db.Exec("PRAGMA query_only=OFF")
+		}
+	}
+	ct.begun <- err
+	if err != nil {
+		ct.err = err
+		return nil, nil
 	}
 
-	for i, v := range values {
-		val := *(v.(*interface{}))
-		dest[i] = driver.Value(val)
+	idle := time.NewTimer(ct.comfy.txTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case request := <-ct.requests:
+			info := JobInfo{ID: ct.id, Query: request.query, Args: request.args}
+			ct.comfy.beforeHooks(info)
+			wait := time.Since(request.sent)
+			endSpan := ct.comfy.startSpan(request.ctx, info, wait)
+			start := time.Now()
+			request.value, request.err = request.fn(tx)
+			duration := time.Since(start)
+			ct.comfy.fireTxHooks()
+			close(request.done)
+			ct.comfy.logQuery(QueryEvent{ID: ct.id, Query: request.query, Args: request.args, Start: start, Duration: duration, Err: request.err})
+			ct.comfy.afterHooks(info, request.value, request.err, duration)
+			ct.comfy.checkSlow(info, duration, wait)
+			endSpan(request.err)
+			if request.end {
+				ct.err = sql.ErrTxDone
+				return nil, nil
+			}
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(ct.comfy.txTimeout)
+		case <-idle.C:
+			tx.Rollback()
+			ct.comfy.fireTxHooks()
+			ct.err = ErrTxAbandoned
+			return nil, nil
+		case <-ct.abandoned:
+			tx.Rollback()
+			ct.comfy.fireTxHooks()
+			ct.err = sql.ErrTxDone
+			return nil, nil
+		case <-ct.comfy.closing:
+			tx.Rollback()
+			ct.comfy.fireTxHooks()
+			ct.err = fmt.Errorf("database is closing: %w", sql.ErrTxDone)
+			return nil, nil
+		}
 	}
+}
 
-	return nil
+// Run a function executing query inside the transaction, on the worker.
+func (ct *comfyTx) do(ctx context.Context, query string, args []interface{}, fn func(tx *sql.Tx) (interface{}, error)) (interface{}, error) {
+	return ct.send(&txRequest{fn: fn, done: make(chan struct{}), query: query, args: len(args), ctx: ctx})
 }
 
-type comfyTx struct {
-	comfy *ComfyDB
+func (ct *comfyTx) send(request *txRequest) (interface{}, error) {
+	request.sent = time.Now()
+	select {
+	case ct.requests <- request:
+	case <-ct.finished:
+		return nil, ct.err
+	}
+	<-request.done
+	return request.value, request.err
+}
+
+// Leave the transaction with a COMMIT or a ROLLBACK.
+func (ct *comfyTx) end(query string, fn func(tx *sql.Tx) error) error {
+	ct.conn.tx = nil
+	_, err := ct.send(&txRequest{
+		fn: func(tx *sql.Tx) (interface{}, error) {
+			return nil, fn(tx)
+		},
+		end:   true,
+		done:  make(chan struct{}),
+		query: query,
+	})
+	return err
 }
 
 func (ct *comfyTx) Commit() error {
-	return nil
+	return ct.end("COMMIT", (*sql.Tx).Commit)
 }
 
 func (ct *comfyTx) Rollback() error {
-	return nil
+	return ct.end("ROLLBACK", (*sql.Tx).Rollback)
+}
+
+// Nested transaction emulated with a savepoint of the transaction in progress.
+type comfySavepoint struct {
+	tx   *comfyTx
+	name string
+}
+
+// Open a savepoint for a nested BeginTx, named after its depth.
+func (ct *comfyTx) savepoint() (driver.Tx, error) {
+	ct.depth++
+	sp := &comfySavepoint{tx: ct, name: fmt.Sprintf("comfy_savepoint_%d", ct.depth)}
+	if err := sp.exec("SAVEPOINT " + sp.name); err != nil {
+		ct.depth--
+		return nil, err
+	}
+	return sp, nil
+}
+
+func (sp *comfySavepoint) exec(query string) error {
+	_, err := sp.tx.do(context.Background(), query, nil, func(tx *sql.Tx) (interface{}, error) {
+		sp.tx.comfy.echoQuery(query, nil)
+		return tx.Exec(query)
+	})
+	return err
+}
+
+// Commit releases the savepoint, its changes become part of the outer transaction.
+func (sp *comfySavepoint) Commit() error {
+	sp.tx.depth--
+	return sp.exec("RELEASE " + sp.name)
+}
+
+// Rollback undoes the changes since the savepoint, the outer transaction goes on.
+func (sp *comfySavepoint) Rollback() error {
+	sp.tx.depth--
+	if err := sp.exec("ROLLBACK TO " + sp.name); err != nil {
+		return err
+	}
+	return sp.exec("RELEASE " + sp.name)
 }
 
 func convertValues(vals []driver.Value) []interface{} {
@@ -143,6 +546,78 @@ func convertValues(vals []driver.Value) []interface{} {
 	return result
 }
 
+// Count the anonymous placeholders of a query, outside of literals, quoted identifiers and comments.
+// Returns -1 when the query uses `?NNN`, `:name`, `@name` or `$name` placeholders.
+func countPlaceholders(query string) int {
+	count := 0
+	for i := 0; i < len(query); i++ {
+		switch r := query[i]; {
+		case r == '\'' || r == '"' || r == '`' || r == '[':
+			closing := r
+			if r == '[' {
+				closing = ']'
+			}
+			// a doubled quote is an escaped quote, scanning it as two literals gives the same result
+			for i++; i < len(query) && query[i] != closing; i++ {
+			}
+		case r == '-' && i+1 < len(query) && query[i+1] == '-':
+			for ; i < len(query) && query[i] != '\n'; i++ {
+			}
+		case r == '/' && i+1 < len(query) && query[i+1] == '*':
+			for i += 2; i+1 < len(query) && !(query[i] == '*' && query[i+1] == '/'); i++ {
+			}
+			i++
+		case r == '?':
+			if i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9' {
+				return -1
+			}
+			count++
+		case r == ':' || r == '@' || r == '$':
+			if i+1 < len(query) && isIdentifierStart(query[i+1]) {
+				return -1
+			}
+		}
+	}
+	return count
+}
+
+func isIdentifierStart(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// Named values keep their name so they bind to :name, @name or $name placeholders.
+func convertNamedValues(vals []driver.NamedValue) []interface{} {
+	result := make([]interface{}, len(vals))
+	for i, v := range vals {
+		if v.Name != "" {
+			result[i] = sql.Named(v.Name, v.Value)
+		} else {
+			result[i] = v.Value
+		}
+	}
+	return result
+}
+
+// Named arguments written like their placeholder, sql.Named(":id", 5), are named "id" for database/sql,
+// which requires a name starting with a letter. SQLite binds "id" to :id, @id and $id alike.
+// Only the methods of ComfyDB get there: through OpenDB, database/sql refuses the name before the driver sees it.
+func trimNamedPrefixes(args []interface{}) []interface{} {
+	trimmed := args
+	for i, arg := range args {
+		named, ok := arg.(sql.NamedArg)
+		if !ok || len(named.Name) < 2 || !strings.ContainsRune(":@$", rune(named.Name[0])) {
+			continue
+		}
+		if &trimmed[0] == &args[0] {
+			// the arguments are the caller's
+			trimmed = append([]interface{}(nil), args...)
+		}
+		named.Name = named.Name[1:]
+		trimmed[i] = named
+	}
+	return trimmed
+}
+
 type OpenDBOptions struct {
 	options         []string
 	withForeignKeys bool
@@ -150,6 +625,8 @@ type OpenDBOptions struct {
 
 type OpenDBOption func(*OpenDBOptions)
 
+// WithForeignKeys enables the foreign key constraints for the statements of the sql.DB, and of the whole ComfyDB since
+// they share the worker connection. The pragma is kept for Reopen like the ones of SetPragma.
 func WithForeignKeys() func(*OpenDBOptions) {
 	return func(o *OpenDBOptions) {
 		o.withForeignKeys = true
@@ -163,7 +640,13 @@ func WithOption(options string) func(*OpenDBOptions) {
 }
 
 // OpenDB creates a new sql.DB instance using ComfyDB
+// Its named arguments need a name starting with a letter, sql.Named("id", 5) rather than sql.Named(":id", 5).
+// With WithDSN its connection string is the DSN as is: passing WithOption too fails every use of the sql.DB.
 func OpenDB(comfy *ComfyDB, opts ...OpenDBOption) *sql.DB {
+	if comfy.dsn != "" {
+		return openDSN(comfy, opts)
+	}
+
 	connStr := comfy.conn
 
 	// If comfy.conn is empty, use the default connection string
@@ -211,7 +694,7 @@ func OpenDB(comfy *ComfyDB, opts ...OpenDBOption) *sql.DB {
 		connStr += strings.Join(newOptions, "&")
 	}
 
-	// fmt.Printf("Connection string: %s\n", connStr) // Debug print
+	comfy.echof("-- OpenDB connection string: %s", connStr)
 
 	db := sql.OpenDB(&ComfyDriver{
 		comfy:   comfy,
@@ -220,11 +703,31 @@ func OpenDB(comfy *ComfyDB, opts ...OpenDBOption) *sql.DB {
 
 	// Explicitly enable foreign keys
 	if cfg.withForeignKeys {
-		_, err := db.Exec("PRAGMA foreign_keys = ON;")
-		if err != nil {
-			fmt.Printf("Error setting foreign_keys pragma: %v\n", err)
-		}
+		comfy.enableForeignKeys()
 	}
 
 	return db
 }
+
+// OpenDB for a ComfyDB of WithDSN: nothing is merged into the DSN.
+func openDSN(comfy *ComfyDB, opts []OpenDBOption) *sql.DB {
+	cfg := OpenDBOptions{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	cd := &ComfyDriver{
+		comfy:   comfy,
+		connStr: comfy.dsn,
+	}
+	if len(cfg.options) > 0 {
+		cd.err = fmt.Errorf("WithOption can't be combined with WithDSN, add %s to the DSN", strings.Join(cfg.options, "&"))
+	}
+	comfy.echof("-- OpenDB connection string: %s", cd.connStr)
+
+	db := sql.OpenDB(cd)
+	if cfg.withForeignKeys && cd.err == nil {
+		comfy.enableForeignKeys()
+	}
+	return db
+}
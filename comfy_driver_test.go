@@ -0,0 +1,592 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDriverTransaction(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS accounts (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO accounts (name) VALUES (?)", "rolled back"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO accounts (name) VALUES (?)", "committed"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a concurrent job must wait for the transaction to end
+	var wg sync.WaitGroup
+	var count int
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := comfyMe.QueryRow("SELECT COUNT(*) FROM accounts").Scan(&count); err != nil {
+			t.Error(err)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	var inTx int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM accounts").Scan(&inTx); err != nil {
+		t.Fatal(err)
+	}
+	if inTx != 1 {
+		t.Fatalf("expected 1 row inside the transaction, got %d", inTx)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if count != 1 {
+		t.Fatalf("expected the concurrent job to see the committed row only, got %d rows", count)
+	}
+}
+
+func TestDriverReadOnlyTransaction(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS readonly_tx (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM readonly_tx").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO readonly_tx VALUES ('refused')"); err == nil || !strings.Contains(err.Error(), "readonly") {
+		t.Fatalf("expected the read-only transaction to refuse the write, got %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("INSERT INTO readonly_tx VALUES ('accepted')"); err != nil {
+		t.Fatalf("expected writes once the read-only transaction is over, got %v", err)
+	}
+}
+
+func TestCountPlaceholders(t *testing.T) {
+	cases := map[string]int{
+		"SELECT 1":                                   0,
+		"INSERT INTO t (a, b) VALUES (?, ?)":         2,
+		"SELECT '?' || ?":                            1,
+		"SELECT \"a?\" FROM t WHERE b = ?":           1,
+		"SELECT 'it''s ?', ? -- why?\n, ?":           2,
+		"SELECT /* ? */ ?":                           1,
+		"SELECT [col?] FROM t WHERE a = ? AND b = ?": 2,
+		"SELECT ?1, ?2":                              -1,
+		"SELECT * FROM t WHERE id = :id":             -1,
+		"SELECT * FROM t WHERE id = @id OR name = ?": -1,
+		"SELECT * FROM t WHERE id = $id":             -1,
+		"SELECT time('12:00')":                       0,
+	}
+	for query, expected := range cases {
+		if count := countPlaceholders(query); count != expected {
+			t.Errorf("%q: expected %d placeholders, got %d", query, expected, count)
+		}
+	}
+}
+
+func TestDriverNumInput(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+
+	stmt, err := db.Prepare("SELECT ?, ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(1); err == nil || !strings.Contains(err.Error(), "expected 2 arguments, got 1") {
+		t.Fatalf("expected database/sql to check the arguments, got %v", err)
+	}
+	if _, err := stmt.Exec(1, 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDriverTransactionAbandoned(t *testing.T) {
+	comfyMe, err := New(WithMemory(), WithTxTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS abandoned (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO abandoned (name) VALUES (?)", "forgotten"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the worker is released once the transaction timed out
+	var count int
+	if err := comfyMe.QueryRow("SELECT COUNT(*) FROM abandoned").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("expected the abandoned transaction to be rolled back, got %d rows", count)
+	}
+
+	if _, err := tx.Exec("INSERT INTO abandoned (name) VALUES (?)", "too late"); !errors.Is(err, ErrTxAbandoned) {
+		t.Fatalf("expected ErrTxAbandoned, got %v", err)
+	}
+	tx.Rollback()
+}
+
+var (
+	_ driver.ExecerContext     = (*comfyConn)(nil)
+	_ driver.QueryerContext    = (*comfyConn)(nil)
+	_ driver.NamedValueChecker = (*comfyConn)(nil)
+	_ driver.Pinger            = (*comfyConn)(nil)
+	_ driver.Result            = (*comfyResult)(nil)
+	_ driver.StmtExecContext   = (*comfyStmt)(nil)
+	_ driver.StmtQueryContext  = (*comfyStmt)(nil)
+)
+
+func TestDriverNamed(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS named (id INTEGER PRIMARY KEY, name TEXT, alias TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT OR REPLACE INTO named (id, name, alias) VALUES (@id, :name, :name)", sql.Named("id", 7), sql.Named("name", "rex")); err != nil {
+		t.Fatal(err)
+	}
+
+	var name, alias string
+	if err := db.QueryRow("SELECT name, alias FROM named WHERE id = @id", sql.Named("id", 7)).Scan(&name, &alias); err != nil {
+		t.Fatal(err)
+	}
+	if name != "rex" || alias != "rex" {
+		t.Fatalf("expected the same name bound twice, got %q and %q", name, alias)
+	}
+
+	stmt, err := db.Prepare("SELECT :name || '-' || :name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	var twice string
+	if err := stmt.QueryRow(sql.Named("name", "felix")).Scan(&twice); err != nil {
+		t.Fatal(err)
+	}
+	if twice != "felix-felix" {
+		t.Fatalf("expected felix-felix, got %q", twice)
+	}
+}
+
+func TestNamedPrefixes(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if _, err := comfyMe.Exec("CREATE TABLE IF NOT EXISTS prefixed (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	args := []interface{}{sql.Named(":id", 8), sql.Named("$name", "rex")}
+	if _, err := comfyMe.Exec("INSERT OR REPLACE INTO prefixed (id, name) VALUES (:id, $name)", args...); err != nil {
+		t.Fatal(err)
+	}
+	if args[0].(sql.NamedArg).Name != ":id" {
+		t.Fatal("expected the arguments of the caller to be left alone")
+	}
+	var name string
+	if err := comfyMe.QueryRow("SELECT name FROM prefixed WHERE id = @id", sql.Named("@id", 8)).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "rex" {
+		t.Fatalf("expected rex, got %q", name)
+	}
+
+	// database/sql validates the names before the driver sees them
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("SELECT :id", sql.Named(":id", 8)); err == nil {
+		t.Fatal("expected database/sql to refuse a prefixed name through OpenDB")
+	}
+	if err := db.QueryRow("SELECT name FROM prefixed WHERE id = :id", sql.Named("id", 8)).Scan(&name); err != nil || name != "rex" {
+		t.Fatalf("expected rex, got %q %v", name, err)
+	}
+}
+
+func TestDriverContext(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS contexts (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO contexts (name) VALUES (?)", "kept"); err != nil {
+		t.Fatal(err)
+	}
+
+	// keep the worker busy so the next query stays queued
+	release := make(chan struct{})
+	busyID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	cancelled, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := db.ExecContext(cancelled, "INSERT INTO contexts (name) VALUES (?)", "dropped"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	stmt, err := db.Prepare("INSERT INTO contexts (name) VALUES (?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.ExecContext(cancelled, "dropped"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the statement to be dropped with its context, got %v", err)
+	}
+	if _, err := comfyMe.ExecContext(cancelled, "INSERT INTO contexts (name) VALUES (?)", "dropped"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected ComfyDB.ExecContext to be dropped with its context, got %v", err)
+	}
+	if _, err := comfyMe.QueryContext(cancelled, "SELECT name FROM contexts"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected ComfyDB.QueryContext to be dropped with its context, got %v", err)
+	}
+	var name string
+	if err := comfyMe.QueryRowContext(cancelled, "SELECT name FROM contexts").Scan(&name); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected ComfyDB.QueryRowContext to be dropped with its context, got %v", err)
+	}
+	close(release)
+	<-comfyMe.WaitForChn(busyID)
+
+	rows, err := db.QueryContext(ctx, "SELECT name FROM contexts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if len(names) != 1 || names[0] != "kept" {
+		t.Fatalf("expected only the kept row, got %v", names)
+	}
+}
+
+var (
+	_ driver.ConnBeginTx                    = (*comfyConn)(nil)
+	_ driver.ExecerContext                  = (*comfyConn)(nil)
+	_ driver.NamedValueChecker              = (*comfyConn)(nil)
+	_ driver.QueryerContext                 = (*comfyConn)(nil)
+	_ driver.StmtExecContext                = (*comfyStmt)(nil)
+	_ driver.StmtQueryContext               = (*comfyStmt)(nil)
+	_ driver.RowsColumnTypeScanType         = (*comfyRows)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*comfyRows)(nil)
+	_ driver.RowsColumnTypeNullable         = (*comfyRows)(nil)
+)
+
+func TestDriverColumnTypes(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS typed (id INTEGER PRIMARY KEY, name TEXT NOT NULL, data BLOB)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO typed (name, data) VALUES (?, ?)", "typed", []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT id, name, data FROM typed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"INTEGER", "TEXT", "BLOB"}
+	for i, ct := range types {
+		if ct.DatabaseTypeName() != expected[i] {
+			t.Fatalf("expected column %s to be %s, got %s", ct.Name(), expected[i], ct.DatabaseTypeName())
+		}
+	}
+
+	if !rows.Next() {
+		t.Fatal("expected a row")
+	}
+	var id interface{}
+	var name string
+	var data interface{}
+	if err := rows.Scan(&id, &name, &data); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := id.(int64); !ok {
+		t.Fatalf("expected id to be an int64, got %T", id)
+	}
+	if blob, ok := data.([]byte); !ok || len(blob) != 3 {
+		t.Fatalf("expected data to be a 3 bytes []byte, got %T %v", data, data)
+	}
+}
+
+func TestDriverColumnTypesWithoutRows(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS typed_empty (id INTEGER PRIMARY KEY, name TEXT NOT NULL, created DATETIME)"); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(rows *sql.Rows, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(types) != 3 || types[0].DatabaseTypeName() != "INTEGER" || types[2].DatabaseTypeName() != "DATETIME" {
+			t.Fatalf("expected the column types of an empty result set, got %v", types)
+		}
+		if scanType := types[2].ScanType(); scanType != reflect.TypeOf(sql.NullTime{}) {
+			t.Fatalf("expected DATETIME to scan into a sql.NullTime, got %v", scanType)
+		}
+	}
+	expect(db.Query("SELECT id, name, created FROM typed_empty WHERE 0"))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	expect(tx.Query("SELECT id, name, created FROM typed_empty WHERE 0"))
+}
+
+func TestDriverLastInsertId(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS inserted (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("goroutine-%d", i)
+			result, err := db.Exec("INSERT INTO inserted (name) VALUES (?)", name)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			id, err := result.LastInsertId()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+				t.Errorf("expected 1 row affected, got %v %v", affected, err)
+			}
+			var stored string
+			if err := db.QueryRow("SELECT name FROM inserted WHERE id = ?", id).Scan(&stored); err != nil {
+				t.Error(err)
+				return
+			}
+			if stored != name {
+				t.Errorf("expected id %d to be %s, got %s", id, name, stored)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestOpenDBWithDSN(t *testing.T) {
+	path := t.TempDir() + "/dsn.db"
+	if _, err := New(WithDSN("file:"+path), WithPath(path)); err == nil || !strings.Contains(err.Error(), "WithPath") {
+		t.Fatalf("expected WithDSN to conflict with WithPath, got %v", err)
+	}
+
+	comfyMe, err := New(WithDSN("file:" + path + "?_journal_mode=WAL&_txlock=immediate"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	mode, err := comfyMe.GetPragma("journal_mode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Fatalf("expected the DSN to set journal_mode, got %s", mode)
+	}
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE dsn_users (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	merged := OpenDB(comfyMe, WithOption("_fk=1"))
+	defer merged.Close()
+	if _, err := merged.Exec("SELECT 1"); err == nil || !strings.Contains(err.Error(), "WithDSN") {
+		t.Fatalf("expected WithOption to conflict with WithDSN, got %v", err)
+	}
+}
+
+func TestOpenDBRowsSnapshot(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS snapshot_users (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM snapshot_users"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := db.Exec("INSERT INTO snapshot_users (name) VALUES (?)", fmt.Sprintf("user%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := db.Query("SELECT name FROM snapshot_users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	// the open rows don't hold the worker's connection, the inserts go through while they're iterated
+	inserted := make(chan error)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			if _, err := comfyMe.Exec("INSERT INTO snapshot_users (name) VALUES (?)", "late"); err != nil {
+				inserted <- err
+				return
+			}
+		}
+		inserted <- nil
+	}()
+
+	count := 0
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		if name == "late" {
+			t.Fatal("expected the rows to be a snapshot of the query")
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count != 10 {
+		t.Fatalf("expected 10 rows, got %d", count)
+	}
+	select {
+	case err := <-inserted:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the inserts not to wait for the rows")
+	}
+}
@@ -0,0 +1,183 @@
+package comfylite3
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Schema object of the database, as stored in sqlite_master.
+type schemaObject struct {
+	kind string
+	name string
+	sql  string
+}
+
+// Dump writes the database to w as a SQL script, like the `.dump` command of the sqlite3 shell:
+// the schema of every table followed by its rows as INSERT statements, then indexes, triggers and views,
+// all wrapped in BEGIN/COMMIT. The migrations table is created by New, only its rows are dumped.
+//
+// The dump is a single worker job reading inside a transaction, so it's consistent, and w is written from the worker:
+// a slow writer holds the other jobs back. Virtual tables are not handled.
+func (c *ComfyDB) Dump(w io.Writer) error {
+	dumpID := c.New(func(db *sql.DB) (interface{}, error) {
+		c.echoQuery("SELECT type, name, sql FROM sqlite_master", nil)
+		return nil, dump(db, w, c.migrationTableName)
+	})
+	result, err := c.await(dumpID)
+	if err != nil {
+		return err
+	}
+	if errResult, ok := result.(error); ok {
+		return fmt.Errorf("failed to dump the database: %w", errResult)
+	}
+	return nil
+}
+
+func dump(db *sql.DB, w io.Writer, migrationTable string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY rowid")
+	if err != nil {
+		return err
+	}
+	objects := []schemaObject{}
+	for rows.Next() {
+		var object schemaObject
+		if err := rows.Scan(&object.kind, &object.name, &object.sql); err != nil {
+			rows.Close()
+			return err
+		}
+		objects = append(objects, object)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	// foreign keys are checked at COMMIT, tables can be loaded in any order
+	fmt.Fprint(out, "BEGIN TRANSACTION;\nPRAGMA defer_foreign_keys=ON;\n")
+	sequence := false
+	for _, object := range objects {
+		if object.kind != "table" {
+			continue
+		}
+		if object.name == "sqlite_sequence" {
+			// created along with the first AUTOINCREMENT table, only its rows are dumped
+			sequence = true
+			continue
+		}
+		if strings.HasPrefix(object.name, "sqlite_") {
+			continue
+		}
+		if strings.EqualFold(object.name, migrationTable) {
+			// New already created it, only its rows are dumped
+			fmt.Fprintf(out, "DELETE FROM %s;\n", quoteIdentifier(object.name))
+		} else {
+			fmt.Fprintf(out, "%s;\n", object.sql)
+		}
+		if err := dumpRows(tx, out, object.name); err != nil {
+			return err
+		}
+	}
+	if sequence {
+		fmt.Fprint(out, "DELETE FROM sqlite_sequence;\n")
+		if err := dumpRows(tx, out, "sqlite_sequence"); err != nil {
+			return err
+		}
+	}
+	for _, object := range objects {
+		if object.kind == "table" {
+			continue
+		}
+		fmt.Fprintf(out, "%s;\n", object.sql)
+	}
+	fmt.Fprint(out, "COMMIT;\n")
+	return out.Flush()
+}
+
+// Write the rows of a table as INSERT statements, SQLite's quote() formats the values as literals.
+func dumpRows(tx *sql.Tx, out io.Writer, table string) error {
+	columns, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = fmt.Sprintf("quote(%s)", quoteIdentifier(column))
+	}
+	rows, err := tx.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), quoteIdentifier(table)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]string, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "INSERT INTO %s VALUES(%s);\n", quoteIdentifier(table), strings.Join(values, ","))
+	}
+	return rows.Err()
+}
+
+// Names of the columns of a table.
+func tableColumns(tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := []string{}
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// Quote an identifier for SQLite.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Load executes a SQL script read from r on the worker, typically one written by Dump.
+// When a statement fails the transaction it opened, if any, is rolled back.
+func (c *ComfyDB) Load(r io.Reader) error {
+	script, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read the script: %w", err)
+	}
+	statements := splitStatements(string(script))
+	loadID := c.New(func(db *sql.DB) (interface{}, error) {
+		if _, err := execStatements(db, statements); err != nil {
+			// nothing to roll back when the script had no transaction
+			db.Exec("ROLLBACK")
+			return nil, err
+		}
+		return nil, nil
+	})
+	result, err := c.await(loadID)
+	if err != nil {
+		return err
+	}
+	if errResult, ok := result.(error); ok {
+		return fmt.Errorf("failed to load the script: %w", errResult)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package comfylite3
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDumpLoad(t *testing.T) {
+	source, err := New(WithPath(filepath.Join(t.TempDir(), "source.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	if _, err := source.ExecScriptDetailed(`
+CREATE TABLE authors (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT);
+CREATE TABLE "odd ""table""" (author_id INTEGER REFERENCES authors (id), note TEXT, data BLOB, score REAL);
+CREATE INDEX odd_author ON "odd ""table""" (author_id);
+CREATE VIEW named AS SELECT name FROM authors;
+`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Exec("INSERT INTO authors (name) VALUES (?), (?)", "O'Brien", "multi\nline"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Exec(`INSERT INTO "odd ""table""" VALUES (?, ?, ?, ?), (?, NULL, NULL, ?)`, 1, "it's; fine", []byte{0, 1, 0xff}, 1.0, 2, 0.1); err != nil {
+		t.Fatal(err)
+	}
+
+	var script bytes.Buffer
+	if err := source.Dump(&script); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(script.String(), "BEGIN TRANSACTION;") || !strings.HasSuffix(script.String(), "COMMIT;\n") {
+		t.Fatalf("expected the dump to be wrapped in a transaction:\n%s", script.String())
+	}
+
+	target, err := New(WithPath(filepath.Join(t.TempDir(), "target.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	if err := target.Load(&script); err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	if err := target.QueryRow("SELECT name FROM named WHERE name LIKE 'O%'").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "O'Brien" {
+		t.Fatalf("expected O'Brien, got %q", name)
+	}
+	var note string
+	var data []byte
+	var score float64
+	if err := target.QueryRow(`SELECT note, data, score FROM "odd ""table""" WHERE author_id = 1`).Scan(&note, &data, &score); err != nil {
+		t.Fatal(err)
+	}
+	if note != "it's; fine" || !bytes.Equal(data, []byte{0, 1, 0xff}) || score != 1.0 {
+		t.Fatalf("unexpected row %q %v %v", note, data, score)
+	}
+	var kind string
+	if err := target.QueryRow(`SELECT typeof(score) FROM "odd ""table""" WHERE author_id = 1`).Scan(&kind); err != nil {
+		t.Fatal(err)
+	}
+	if kind != "real" {
+		t.Fatalf("expected the score to stay a real, got %s", kind)
+	}
+	// the sequence carries over
+	if _, err := target.Exec("INSERT INTO authors (name) VALUES ('next')"); err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if err := target.QueryRow("SELECT id FROM authors WHERE name = 'next'").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if id != 3 {
+		t.Fatalf("expected id 3, got %d", id)
+	}
+
+	// a failing script leaves nothing behind
+	if err := target.Load(strings.NewReader("BEGIN; INSERT INTO authors (name) VALUES ('ghost'); INSERT INTO missing VALUES (1); COMMIT;")); err == nil {
+		t.Fatal("expected the script to fail")
+	}
+	var ghosts int
+	if err := target.QueryRow("SELECT COUNT(*) FROM authors WHERE name = 'ghost'").Scan(&ghosts); err != nil {
+		t.Fatal(err)
+	}
+	if ghosts != 0 {
+		t.Fatalf("expected the failed load to be rolled back, got %d rows", ghosts)
+	}
+}
@@ -0,0 +1,66 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// WithEncryptionKey applies PRAGMA key to every connection right after it opens, before any other statement,
+// to open a database encrypted with SQLCipher. It requires go-sqlite3 built against SQLCipher:
+// New fails with ErrUnsupported otherwise rather than leaving the database in clear.
+func WithEncryptionKey(key string) ComfyOption {
+	return func(c *ComfyDB) {
+		c.encryptionKey.Store(&key)
+	}
+}
+
+// Quote a key for PRAGMA key and PRAGMA rekey.
+func quoteKey(key string) string {
+	return "'" + strings.ReplaceAll(key, "'", "''") + "'"
+}
+
+// Whether WithEncryptionKey set a key.
+func (c *ComfyDB) encrypted() bool {
+	key := c.encryptionKey.Load()
+	return key != nil && *key != ""
+}
+
+// Connect hook of WithEncryptionKey, the first one to run. The key is loaded atomically:
+// Rekey may swap it while a reader connects.
+func (c *ComfyDB) keyHook(conn *rawConn) error {
+	if _, err := conn.Exec("PRAGMA key = "+quoteKey(*c.encryptionKey.Load()), nil); err != nil {
+		return err
+	}
+	// SQLite ignores the pragmas it doesn't know, SQLCipher answers this one
+	rows, err := conn.Query("PRAGMA cipher_version", nil)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if err := rows.Next(make([]driver.Value, len(rows.Columns()))); err != nil {
+		return fmt.Errorf("%w: encryption requires SQLCipher", ErrUnsupported)
+	}
+	return nil
+}
+
+// Rekey re-encrypts the database of WithEncryptionKey with newKey, with PRAGMA rekey. Like Exclusive,
+// nothing else runs meanwhile. The connections opened afterwards, the readers and Reopen included, use newKey.
+func (c *ComfyDB) Rekey(newKey string) error {
+	if !c.encrypted() {
+		return fmt.Errorf("the database isn't encrypted, open it with WithEncryptionKey")
+	}
+	return c.Exclusive(func(db *sql.DB) error {
+		if _, err := db.Exec("PRAGMA rekey = " + quoteKey(newKey)); err != nil {
+			return fmt.Errorf("failed to rekey the database: %w", err)
+		}
+		c.encryptionKey.Store(&newKey)
+		if c.readDB != nil {
+			// the readers are idle while Exclusive runs: reconnect them with the new key
+			c.readDB.SetMaxIdleConns(0)
+			c.readDB.SetMaxIdleConns(c.readers)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,38 @@
+package comfylite3
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEncryptionKey(t *testing.T) {
+	path := t.TempDir() + "/encrypted.db"
+	comfyMe, err := New(WithPath(path), WithEncryptionKey("it's a secret"))
+	if err == nil {
+		// built against SQLCipher
+		defer comfyMe.Close()
+		if _, err := comfyMe.Exec("CREATE TABLE secrets (value TEXT)"); err != nil {
+			t.Fatal(err)
+		}
+		if err := comfyMe.Rekey("another secret"); err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		if err := comfyMe.QueryRow("SELECT COUNT(*) FROM secrets").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported without SQLCipher, got %v", err)
+	}
+
+	clear, err := New(WithPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clear.Close()
+	if err := clear.Rekey("secret"); err == nil {
+		t.Fatal("expected Rekey to fail on a database opened without a key")
+	}
+}
@@ -0,0 +1,147 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// QueryError is the error of a statement run through OpenDB, with the statement it comes from.
+// It wraps the error of the driver: errors.Is and errors.As still reach the sqlite3.Error and its extended code.
+type QueryError struct {
+	ID    uint64 // ticket of the job, or of the transaction, running the statement
+	Query string
+	Args  int // number of bound arguments
+	Err   error
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("job %d: %q with %d args: %v", e.ID, e.Query, e.Args, e.Err)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// Wrap the failure of a statement, nil stays nil.
+func wrapQueryError(id uint64, query string, args []interface{}, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &QueryError{ID: id, Query: query, Args: len(args), Err: classifyError(err)}
+}
+
+// Kinds of SQLite errors, matched with errors.Is on the errors of the jobs and of OpenDB.
+// They don't depend on the error type of the driver, which errors.As still reaches.
+var (
+	ErrConstraintUnique     = errors.New("unique constraint failed")
+	ErrConstraintPrimaryKey = errors.New("primary key constraint failed")
+	ErrConstraintNotNull    = errors.New("not null constraint failed")
+	ErrConstraintForeignKey = errors.New("foreign key constraint failed")
+	ErrConstraintCheck      = errors.New("check constraint failed")
+	ErrBusy                 = errors.New("database is busy or locked")
+	// ErrNoRows is sql.ErrNoRows, for QueryRow and Scan.
+	ErrNoRows = sql.ErrNoRows
+)
+
+// Error of the driver with its kind, its message unchanged.
+type classifiedError struct {
+	err  error
+	kind error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.err, e.kind}
+}
+
+// Attach its kind to a SQLite error so errors.Is tells it, other errors are returned as is.
+func classifyError(err error) error {
+	var classified *classifiedError
+	if err == nil || errors.As(err, &classified) {
+		return err
+	}
+	var kind error
+	switch {
+	case IsConstraintUnique(err):
+		kind = ErrConstraintUnique
+	case IsConstraintPrimaryKey(err):
+		kind = ErrConstraintPrimaryKey
+	case IsConstraintNotNull(err):
+		kind = ErrConstraintNotNull
+	case IsConstraintForeignKey(err):
+		kind = ErrConstraintForeignKey
+	case IsConstraintCheck(err):
+		kind = ErrConstraintCheck
+	case IsBusy(err):
+		kind = ErrBusy
+	default:
+		return err
+	}
+	return &classifiedError{err: err, kind: kind}
+}
+
+// SQLite result codes told apart by comfylite3.
+const (
+	codeBusy                 = 5
+	codeLocked               = 6
+	codeConstraintCheck      = 275
+	codeConstraintForeignKey = 787
+	codeConstraintNotNull    = 1299
+	codeConstraintPrimaryKey = 1555
+	codeConstraintUnique     = 2067
+)
+
+// ResultCode digs the primary and extended SQLite result codes out of an error returned by comfylite3, from a job or
+// through OpenDB: an error of mattn/go-sqlite3, or of modernc.org/sqlite. ok is false when no SQLite error is wrapped in it.
+func ResultCode(err error) (primary int, extended int, ok bool) {
+	if primary, extended, ok := driverResultCode(err); ok {
+		return primary, extended, true
+	}
+	// the extended code of modernc.org/sqlite, the primary one is its low byte
+	var coded interface{ Code() int }
+	if !errors.As(err, &coded) {
+		return 0, 0, false
+	}
+	extended = coded.Code()
+	return extended & 0xff, extended, true
+}
+
+// Is the extended result code of the error the given one.
+func hasExtendedCode(err error, code int) bool {
+	_, extended, ok := ResultCode(err)
+	return ok && extended == code
+}
+
+// IsConstraintUnique tells whether err is a UNIQUE constraint violation.
+func IsConstraintUnique(err error) bool {
+	return hasExtendedCode(err, codeConstraintUnique)
+}
+
+// IsConstraintPrimaryKey tells whether err is a PRIMARY KEY constraint violation.
+func IsConstraintPrimaryKey(err error) bool {
+	return hasExtendedCode(err, codeConstraintPrimaryKey)
+}
+
+// IsConstraintNotNull tells whether err is a NOT NULL constraint violation.
+func IsConstraintNotNull(err error) bool {
+	return hasExtendedCode(err, codeConstraintNotNull)
+}
+
+// IsConstraintForeignKey tells whether err is a FOREIGN KEY constraint violation.
+func IsConstraintForeignKey(err error) bool {
+	return hasExtendedCode(err, codeConstraintForeignKey)
+}
+
+// IsConstraintCheck tells whether err is a CHECK constraint violation.
+func IsConstraintCheck(err error) bool {
+	return hasExtendedCode(err, codeConstraintCheck)
+}
+
+// IsBusy tells whether err is SQLITE_BUSY or SQLITE_LOCKED, the errors WithBusyRetry retries.
+func IsBusy(err error) bool {
+	return isBusy(err)
+}
@@ -0,0 +1,145 @@
+//go:build cgo && !comfylite3_nomattn
+
+package comfylite3
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestQueryError(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS wrapped (name TEXT UNIQUE)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM wrapped"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO wrapped VALUES (?)", "twice"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("INSERT INTO wrapped VALUES (?)", "twice")
+	var queryErr *QueryError
+	if !errors.As(err, &queryErr) {
+		t.Fatalf("expected a QueryError, got %v", err)
+	}
+	if queryErr.Query != "INSERT INTO wrapped VALUES (?)" || queryErr.Args != 1 || queryErr.ID == 0 {
+		t.Fatalf("unexpected context %+v", queryErr)
+	}
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		t.Fatalf("expected the sqlite3 error to be reachable, got %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Query("SELECT missing FROM wrapped"); !errors.As(err, &queryErr) || queryErr.Query != "SELECT missing FROM wrapped" {
+		t.Fatalf("expected a QueryError inside the transaction, got %v", err)
+	}
+}
+
+func TestResultCode(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if _, err := comfyMe.Exec("CREATE TABLE IF NOT EXISTS coded (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("DELETE FROM coded"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO coded (name) VALUES ('taken')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// from a job
+	insertID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return db.Exec("INSERT INTO coded (name) VALUES ('taken')")
+	})
+	_, err = comfyMe.Result(insertID)
+	primary, extended, ok := ResultCode(err)
+	if !ok || primary != int(sqlite3.ErrConstraint) || extended != int(sqlite3.ErrConstraintUnique) {
+		t.Fatalf("unexpected result codes %d %d %v for %v", primary, extended, ok, err)
+	}
+	if !IsConstraintUnique(err) || IsConstraintNotNull(err) || IsBusy(err) {
+		t.Fatalf("misclassified %v", err)
+	}
+
+	// through OpenDB
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	_, err = db.Exec("INSERT INTO coded (name) VALUES (NULL)")
+	if !IsConstraintNotNull(err) || IsConstraintUnique(err) {
+		t.Fatalf("expected a NOT NULL violation, got %v", err)
+	}
+
+	if _, _, ok := ResultCode(errors.New("plain")); ok {
+		t.Fatal("expected no result code for a plain error")
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/kinds.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if err := comfyMe.SetPragma("foreign_keys", "ON"); err != nil {
+		t.Fatal(err)
+	}
+	if err := comfyMe.ExecScript(`
+		CREATE TABLE owners (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE);
+		CREATE TABLE pets (owner INTEGER REFERENCES owners (id), age INTEGER CHECK (age >= 0));
+		INSERT INTO owners (id, name) VALUES (1, 'alice');
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	for query, kind := range map[string]error{
+		"INSERT INTO owners (name) VALUES ('alice')":      ErrConstraintUnique,
+		"INSERT INTO owners (id, name) VALUES (1, 'bob')": ErrConstraintPrimaryKey,
+		"INSERT INTO owners (name) VALUES (NULL)":         ErrConstraintNotNull,
+		"INSERT INTO pets (owner) VALUES (42)":            ErrConstraintForeignKey,
+		"INSERT INTO pets (owner, age) VALUES (1, -1)":    ErrConstraintCheck,
+	} {
+		_, err := comfyMe.Exec(query)
+		if !errors.Is(err, kind) {
+			t.Fatalf("expected %v for %q, got %v", kind, query, err)
+		}
+		var sqliteErr sqlite3.Error
+		if !errors.As(err, &sqliteErr) || err.Error() != sqliteErr.Error() {
+			t.Fatalf("expected the sqlite3 error to be kept as is, got %v", err)
+		}
+	}
+
+	// through OpenDB too
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("INSERT INTO owners (name) VALUES ('alice')"); !errors.Is(err, ErrConstraintUnique) {
+		t.Fatalf("expected ErrConstraintUnique, got %v", err)
+	}
+	var name string
+	if err := comfyMe.QueryRow("SELECT name FROM owners WHERE id = 42").Scan(&name); !errors.Is(err, ErrNoRows) {
+		t.Fatalf("expected ErrNoRows, got %v", err)
+	}
+	if _, err := comfyMe.Exec("SELECT nothing FROM nowhere"); errors.Is(err, ErrBusy) || errors.Is(err, ErrConstraintUnique) {
+		t.Fatalf("expected an unclassified error, got %v", err)
+	}
+}
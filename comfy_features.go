@@ -0,0 +1,95 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupported is returned when the SQLite build doesn't provide a feature.
+var ErrUnsupported = errors.New("unsupported by this sqlite build")
+
+// Features of the SQLite build, detected once.
+type features struct {
+	version        [3]int
+	compileOptions map[string]bool
+}
+
+// Detect the SQLite version and compile options of the worker connection.
+func detectFeatures(db *sql.DB) (*features, error) {
+	f := &features{compileOptions: map[string]bool{}}
+	var version string
+	if err := db.QueryRow("SELECT sqlite_version()").Scan(&version); err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Sscanf(version, "%d.%d.%d", &f.version[0], &f.version[1], &f.version[2]); err != nil {
+		return nil, fmt.Errorf("failed to parse sqlite version %q: %w", version, err)
+	}
+	rows, err := db.Query("PRAGMA compile_options")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var option string
+		if err := rows.Scan(&option); err != nil {
+			return nil, err
+		}
+		// options like MAX_ATTACHED=10 are recorded by name
+		f.compileOptions[strings.SplitN(option, "=", 2)[0]] = true
+	}
+	return f, rows.Err()
+}
+
+// Is the SQLite version at least major.minor.patch.
+func (f *features) atLeast(major, minor, patch int) bool {
+	required := [3]int{major, minor, patch}
+	for i := range required {
+		if f.version[i] != required[i] {
+			return f.version[i] > required[i]
+		}
+	}
+	return true
+}
+
+func (f *features) supports(feature string) bool {
+	switch strings.ToLower(feature) {
+	case "fts5":
+		return f.compileOptions["ENABLE_FTS5"]
+	case "json1":
+		// JSON is built-in since 3.38.0 unless explicitly omitted
+		return f.compileOptions["ENABLE_JSON1"] || (f.atLeast(3, 38, 0) && !f.compileOptions["OMIT_JSON"])
+	case "rtree":
+		return f.compileOptions["ENABLE_RTREE"]
+	case "returning":
+		return f.atLeast(3, 35, 0)
+	default:
+		return false
+	}
+}
+
+// Supports reports whether the SQLite build backing the worker provides a feature:
+// "fts5", "json1", "rtree" or "returning". Unknown features are reported as unsupported.
+//
+// Detection runs on first use, from `sqlite_version()` and `PRAGMA compile_options`, and again on the next call
+// when it failed, while closed for instance.
+func (c *ComfyDB) Supports(feature string) bool {
+	c.featuresMu.Lock()
+	defer c.featuresMu.Unlock()
+	if c.features == nil {
+		featuresID := c.New(func(db *sql.DB) (interface{}, error) {
+			return detectFeatures(db)
+		})
+		result, err := c.await(featuresID)
+		if err != nil {
+			return false
+		}
+		f, ok := result.(*features)
+		if !ok {
+			return false
+		}
+		c.features = f
+	}
+	return c.features.supports(feature)
+}
@@ -0,0 +1,44 @@
+package comfylite3
+
+import (
+	"testing"
+)
+
+func TestSupports(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if !comfyMe.Supports("returning") {
+		t.Fatal("expected the bundled sqlite to support RETURNING")
+	}
+	if !comfyMe.Supports("JSON1") {
+		t.Fatal("expected the bundled sqlite to support JSON")
+	}
+	if comfyMe.Supports("time_travel") {
+		t.Fatal("expected unknown features to be unsupported")
+	}
+}
+
+func TestSupportsAfterFailedDetection(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/features.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if err := comfyMe.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if comfyMe.Supports("returning") {
+		t.Fatal("expected nothing to be supported while closed")
+	}
+	if err := comfyMe.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if !comfyMe.Supports("returning") {
+		t.Fatal("expected the detection to run again after Reopen")
+	}
+}
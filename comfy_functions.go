@@ -0,0 +1,49 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// RegisterFunc registers a Go function as a SQL scalar function, see the mattn/go-sqlite3 documentation of
+// SQLiteConn.RegisterFunc for the supported signatures. A pure function always returns the same result for the
+// same arguments, which lets SQLite use it in indexes and optimize the calls.
+//
+// The function is registered on the worker connection, in a job, and on every connection opened afterwards.
+// Register before the first NewRead so the readers of WithReaders get it too.
+func (c *ComfyDB) RegisterFunc(name string, impl interface{}, pure bool) error {
+	return c.register(name, func(conn *rawConn) error {
+		return conn.RegisterFunc(name, impl, pure)
+	})
+}
+
+// RegisterAggregator registers a Go type as a SQL aggregate function: impl is a constructor returning a value
+// with a Step method, called for each row, and a Done method returning the result.
+// The aggregate is registered as non-deterministic, like RegisterFunc it reaches the worker and the new connections.
+func (c *ComfyDB) RegisterAggregator(name string, impl interface{}) error {
+	return c.register(name, func(conn *rawConn) error {
+		return conn.RegisterAggregator(name, impl, false)
+	})
+}
+
+// Apply a registration to the worker connection and keep it for the connections to come.
+func (c *ComfyDB) register(name string, hook connectHook) error {
+	if !c.mattn() {
+		return fmt.Errorf("%w: functions require the sqlite3 driver", ErrUnsupported)
+	}
+	registerID := c.New(func(db *sql.DB) (interface{}, error) {
+		return nil, withRawConn(db, hook)
+	})
+	result, err := c.await(registerID)
+	if err != nil {
+		return err
+	}
+	if errResult, ok := result.(error); ok {
+		return fmt.Errorf("failed to register %q: %w", name, errResult)
+	}
+
+	c.connectHooksMu.Lock()
+	c.connectHooks = append(c.connectHooks, hook)
+	c.connectHooksMu.Unlock()
+	return nil
+}
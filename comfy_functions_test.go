@@ -0,0 +1,113 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+)
+
+type median struct {
+	values []float64
+}
+
+func (m *median) Step(value float64) {
+	m.values = append(m.values, value)
+}
+
+func (m *median) Done() float64 {
+	if len(m.values) == 0 {
+		return 0
+	}
+	sort.Float64s(m.values)
+	middle := len(m.values) / 2
+	if len(m.values)%2 == 0 {
+		return (m.values[middle-1] + m.values[middle]) / 2
+	}
+	return m.values[middle]
+}
+
+func TestRegisterFunctions(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	err = comfyMe.RegisterFunc("regexp", func(pattern, text string) (bool, error) {
+		return regexp.MatchString(pattern, text)
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := comfyMe.RegisterAggregator("median", func() *median { return &median{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	queryID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		if _, err := db.Exec("CREATE TABLE IF NOT EXISTS measures (label TEXT, value REAL)"); err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec("DELETE FROM measures"); err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec("INSERT INTO measures VALUES ('a1', 1), ('a2', 5), ('b1', 100), ('a3', 2)"); err != nil {
+			return nil, err
+		}
+		var value float64
+		err := db.QueryRow("SELECT median(value) FROM measures WHERE label REGEXP '^a'").Scan(&value)
+		return value, err
+	})
+	value, err := comfyMe.Result(queryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 2.0 {
+		t.Fatalf("expected a median of 2, got %v", value)
+	}
+
+	if err := comfyMe.RegisterFunc("broken", "not a function", true); err == nil {
+		t.Fatal("expected an error registering something that isn't a function")
+	}
+}
+
+func TestRegisterFuncWhileReadersConnect(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir()+"/functions.db"), WithReaders(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	// every read opens a new connection, running the connect hooks
+	comfyMe.readDB.SetMaxIdleConns(0)
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				var n int
+				if err := comfyMe.readDB.QueryRow("SELECT 1").Scan(&n); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		if err := comfyMe.RegisterFunc(fmt.Sprintf("double%d", i), func(n int) int { return 2 * n }, true); err != nil {
+			t.Error(err)
+			break
+		}
+	}
+	close(done)
+	readers.Wait()
+}
@@ -0,0 +1,129 @@
+package comfylite3
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Statements WithGroupCommit coalesces, by first keyword.
+var groupKeywords = map[string]bool{
+	"INSERT":  true,
+	"UPDATE":  true,
+	"DELETE":  true,
+	"REPLACE": true,
+}
+
+// WithGroupCommit coalesces consecutive writes into a single transaction, up to maxBatch of them, so they share
+// one commit and one fsync. The worker waits up to maxDelay for the next write before committing the group:
+// the latency each write pays for the throughput of all.
+//
+// Only the single INSERT, UPDATE, DELETE or REPLACE statements of Exec, ExecContext and OpenDB outside a transaction
+// are grouped, a job of New or any other statement ends the group. Each write runs in its own savepoint: when it fails,
+// only its changes are undone and the others commit. Their tickets are released after the commit, with its error if
+// it fails. A group doesn't start while a transaction of your own, opened with a BEGIN through Exec, is in progress.
+func WithGroupCommit(maxBatch int, maxDelay time.Duration) ComfyOption {
+	return func(c *ComfyDB) {
+		c.groupMax = maxBatch
+		c.groupDelay = maxDelay
+	}
+}
+
+// Can WithGroupCommit coalesce query with the writes around it.
+func (c *ComfyDB) groupable(query string) bool {
+	return c.groupMax > 1 && groupKeywords[firstKeyword(query)] && len(splitStatements(query)) == 1
+}
+
+// Submit an Exec bound to ctx, which WithGroupCommit may coalesce.
+func (c *ComfyDB) submitExec(ctx context.Context, query string, fn SqlContextFn) uint64 {
+	item := c.newWorkItem(fn)
+	item.group = c.groupable(query)
+	return c.submitContext(ctx, item)
+}
+
+// Writes of WithGroupCommit sharing a transaction, with their outcome until it commits.
+type groupBatch struct {
+	items   []*workItem
+	values  []interface{}
+	errs    []error
+	failed  bool  // the last write added failed
+	lostErr error // the transaction is gone, none of the writes is applied
+}
+
+// Keep the outcome of a write, on the worker.
+func (b *groupBatch) add(item *workItem, value interface{}, err error) {
+	b.items = append(b.items, item)
+	b.values = append(b.values, value)
+	b.errs = append(b.errs, err)
+	b.failed = err != nil
+}
+
+// Run first along with the writes queued after it in a single transaction, then release them all.
+func (c *ComfyDB) runGroup(first *workItem) {
+	items := []*workItem{first}
+	deadline := time.Now().Add(c.groupDelay)
+	for len(items) < c.groupMax {
+		item, ok := c.queue.popGroup(deadline)
+		if !ok {
+			break
+		}
+		items = append(items, item)
+	}
+	if len(items) == 1 {
+		c.runWatched(first)
+		return
+	}
+	if _, err := c.db.Exec("BEGIN"); err != nil {
+		// in a transaction of the user's already, each write goes on its own
+		for _, item := range items {
+			c.runWatched(item)
+		}
+		return
+	}
+
+	batch := &groupBatch{}
+	started := 0
+	for _, item := range items {
+		if _, err := c.db.Exec("SAVEPOINT comfy_group"); err != nil {
+			// an interrupted write rolls the whole transaction back
+			batch.lostErr = err
+			break
+		}
+		started++
+		item.batch = batch
+		batch.failed = false
+		c.runWatched(item)
+		if batch.failed {
+			if _, err := c.db.Exec("ROLLBACK TO comfy_group"); err != nil {
+				batch.lostErr = err
+				break
+			}
+		}
+		if _, err := c.db.Exec("RELEASE comfy_group"); err != nil {
+			batch.lostErr = err
+			break
+		}
+	}
+	if batch.lostErr == nil {
+		if _, err := c.db.Exec("COMMIT"); err != nil {
+			batch.lostErr = err
+		}
+	}
+	if batch.lostErr != nil {
+		// nothing to roll back when the transaction is gone already
+		c.db.Exec("ROLLBACK")
+	}
+	c.fireTxHooks()
+
+	for i, item := range batch.items {
+		value, err := batch.values[i], batch.errs[i]
+		if batch.lostErr != nil {
+			value, err = nil, fmt.Errorf("failed to commit the group: %w", batch.lostErr)
+		}
+		item.finish(workRunning, value, err)
+	}
+
+	for _, item := range items[started:] {
+		c.runWatched(item)
+	}
+}
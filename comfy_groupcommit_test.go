@@ -0,0 +1,88 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupCommit(t *testing.T) {
+	var commits atomic.Int32
+	comfyMe, err := New(
+		WithPath(t.TempDir()+"/group.db"),
+		WithGroupCommit(64, 20*time.Millisecond),
+		WithCommitHook(func() int {
+			commits.Add(1)
+			return 0
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if _, err := comfyMe.Exec("CREATE TABLE grouped (id INTEGER PRIMARY KEY, name TEXT UNIQUE)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO grouped (name) VALUES ('taken')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the writes pile up behind a job, then the worker serves them as one group
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blockingID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	defer comfyMe.Forget(blockingID)
+	<-started
+	commits.Store(0)
+
+	var wg sync.WaitGroup
+	var failures atomic.Int32
+	for i := 0; i < 50; i++ {
+		name := "taken"
+		if i > 0 {
+			name = string(rune('a'+i%26)) + string(rune('a'+i/26))
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := comfyMe.Exec("INSERT INTO grouped (name) VALUES (?)", name); err != nil {
+				failures.Add(1)
+			}
+		}()
+	}
+	for comfyMe.Metrics().Pending < 50 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if failures.Load() != 1 {
+		t.Fatalf("expected the duplicate alone to fail, got %d failures", failures.Load())
+	}
+	if n := commits.Load(); n != 1 {
+		t.Fatalf("expected the writes to share a commit, got %d", n)
+	}
+	var count int
+	if err := comfyMe.QueryRow("SELECT COUNT(*) FROM grouped").Scan(&count); err != nil || count != 50 {
+		t.Fatalf("expected 50 rows, got %d %v", count, err)
+	}
+
+	// a lone write doesn't wait for a group forever
+	start := time.Now()
+	if _, err := comfyMe.Exec("DELETE FROM grouped"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected a lone write to commit after the delay, took %v", elapsed)
+	}
+
+	if _, err := New(WithMemory(), WithGroupCommit(8, -time.Second)); err == nil {
+		t.Fatal("expected an error for a negative delay")
+	}
+}
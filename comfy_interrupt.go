@@ -0,0 +1,40 @@
+package comfylite3
+
+// Make the job running on the worker interruptible, or nothing when id is zero.
+func (c *ComfyDB) interruptible(id uint64) {
+	c.interruptMu.Lock()
+	defer c.interruptMu.Unlock()
+	c.interruptID = id
+}
+
+// Interrupt the job if it's still the one running on the worker.
+func (c *ComfyDB) interruptJob(id uint64) bool {
+	c.interruptMu.Lock()
+	defer c.interruptMu.Unlock()
+	if c.interruptID == 0 || c.interruptID != id {
+		return false
+	}
+	conn := c.workerConn.Load()
+	if conn == nil {
+		return false
+	}
+	if err := interruptConn(conn); err != nil {
+		c.warnings().Warn("comfylite3: interrupting the worker failed", "id", id, "error", err)
+		return false
+	}
+	return true
+}
+
+// Interrupt aborts the statement running on the worker with SQLITE_INTERRUPT, as SQLite's sqlite3_interrupt does.
+// The job gets the error of the statement and decides what follows, a transaction in progress is not rolled back.
+// It returns false when no job was running, or when the handle of the connection couldn't be reached, with a warning
+// to WithSlog. The readers of WithReaders are not affected.
+//
+// A job running past its deadline (WithJobTimeout, NewWithTimeout) or whose context is done (NewContext) is interrupted
+// the same way, even when it doesn't pass its context to its queries.
+func (c *ComfyDB) Interrupt() bool {
+	c.interruptMu.Lock()
+	id := c.interruptID
+	c.interruptMu.Unlock()
+	return c.interruptJob(id)
+}
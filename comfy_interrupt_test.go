@@ -0,0 +1,71 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Counts long enough to run for minutes.
+const endlessQuery = "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT COUNT(*) FROM n"
+
+func TestInterrupt(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if comfyMe.Interrupt() {
+		t.Fatal("expected nothing to interrupt on an idle worker")
+	}
+
+	started := make(chan struct{})
+	queryID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		close(started)
+		var count int
+		// no context, only Interrupt can stop it
+		err := db.QueryRow(endlessQuery).Scan(&count)
+		return count, err
+	})
+	<-started
+	time.Sleep(20 * time.Millisecond)
+	if !comfyMe.Interrupt() {
+		t.Fatal("expected the running job to be interrupted")
+	}
+	if _, err := comfyMe.Result(queryID); err == nil || !strings.Contains(err.Error(), "interrupt") {
+		t.Fatalf("expected SQLITE_INTERRUPT, got %v", err)
+	}
+}
+
+func TestInterruptOnTimeout(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	queryID := comfyMe.NewWithTimeout(50*time.Millisecond, func(ctx context.Context, db *sql.DB) (interface{}, error) {
+		var count int
+		err := db.QueryRow(endlessQuery).Scan(&count)
+		return count, err
+	})
+	if _, err := comfyMe.Result(queryID); !errors.Is(err, ErrJobTimeout) {
+		t.Fatalf("expected ErrJobTimeout, got %v", err)
+	}
+
+	// the worker is free again right away
+	start := time.Now()
+	nextID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return nil, nil
+	})
+	if _, err := comfyMe.Result(nextID); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the query to be interrupted, the next job waited %v", elapsed)
+	}
+}
@@ -0,0 +1,159 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Size of each blob written while preallocating.
+const preallocateChunk = 16 << 20
+
+// Preallocate grows the database file to at least `bytes` so heavy inserts don't pay for repeated file extensions.
+// It writes zero-filled blobs into a scratch table and drops it: the pages land on the freelist and get reused by future inserts.
+//
+// Caveats:
+//   - with `auto_vacuum=FULL` the freed pages are returned to the OS immediately, with `INCREMENTAL` on the next `incremental_vacuum`, and `VACUUM` always shrinks the file back;
+//   - in WAL mode the pages are first written to the WAL and only reach the database file on checkpoint;
+//   - the file is really written (not sparse), so it costs I/O once, and it's meaningless for in-memory databases.
+func (c *ComfyDB) Preallocate(bytes int64) error {
+	if bytes <= 0 {
+		return fmt.Errorf("invalid preallocation size %d", bytes)
+	}
+	preallocateID := c.New(func(db *sql.DB) (interface{}, error) {
+		var pageSize, pageCount int64
+		if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+			return nil, err
+		}
+		if err := db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+			return nil, err
+		}
+		missing := bytes - pageSize*pageCount
+		if missing <= 0 {
+			return nil, nil
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("CREATE TABLE _comfy_preallocate (data BLOB)"); err != nil {
+			return nil, err
+		}
+		for missing > 0 {
+			size := min(missing, preallocateChunk)
+			if _, err := tx.Exec("INSERT INTO _comfy_preallocate (data) VALUES (zeroblob(?))", size); err != nil {
+				return nil, fmt.Errorf("failed to preallocate %d bytes: %w", bytes, err)
+			}
+			missing -= size
+		}
+		if _, err := tx.Exec("DROP TABLE _comfy_preallocate"); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	})
+	result, err := c.await(preallocateID)
+	if err != nil {
+		return err
+	}
+	if errResult, ok := result.(error); ok {
+		return errResult
+	}
+	return nil
+}
+
+// Vacuum rebuilds the database file with `VACUUM`, returning the free pages to the OS and defragmenting the tables.
+// It runs as a single worker job that rewrites the whole database: every other job waits until it's done.
+// SQLite can't vacuum inside a transaction, Vacuum fails while one opened through OpenDB is in progress.
+func (c *ComfyDB) Vacuum() error {
+	if open := c.openTxs.Load(); open > 0 {
+		return fmt.Errorf("can't vacuum while %d transactions are open", open)
+	}
+	vacuumID := c.New(func(db *sql.DB) (interface{}, error) {
+		c.echoQuery("VACUUM", nil)
+		_, err := db.Exec("VACUUM")
+		return nil, err
+	})
+	result, err := c.await(vacuumID)
+	if err != nil {
+		return err
+	}
+	if errResult, ok := result.(error); ok {
+		return fmt.Errorf("failed to vacuum: %w", errResult)
+	}
+	return nil
+}
+
+// IncrementalVacuum returns up to `pages` free pages to the OS, all of them when pages <= 0.
+// It only does something with `auto_vacuum=INCREMENTAL`, see WithAutoVacuum.
+func (c *ComfyDB) IncrementalVacuum(pages int) error {
+	query := "PRAGMA incremental_vacuum"
+	if pages > 0 {
+		query = fmt.Sprintf("PRAGMA incremental_vacuum(%d)", pages)
+	}
+	vacuumID := c.New(func(db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, nil)
+		// SQLite frees a page per step, Exec would only step once
+		rows, err := db.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		return nil, rows.Err()
+	})
+	result, err := c.await(vacuumID)
+	if err != nil {
+		return err
+	}
+	if errResult, ok := result.(error); ok {
+		return fmt.Errorf("failed to vacuum incrementally: %w", errResult)
+	}
+	return nil
+}
+
+// WithAutoVacuum sets `PRAGMA auto_vacuum` when the database opens: "NONE", "FULL" or "INCREMENTAL".
+// It applies as is to a new database, through the connection string. An existing one only switches between NONE and the other modes on the next Vacuum.
+func WithAutoVacuum(mode string) ComfyOption {
+	return func(c *ComfyDB) {
+		c.autoVacuum = strings.ToUpper(mode)
+	}
+}
+
+// Add the DSN parameter of WithAutoVacuum first, so it applies before the journal mode creates the file.
+func (c *ComfyDB) autoVacuumDSN(dsn string) (string, error) {
+	switch c.autoVacuum {
+	case "":
+		return dsn, nil
+	case "NONE", "FULL", "INCREMENTAL":
+	default:
+		return "", fmt.Errorf("invalid auto_vacuum mode %q", c.autoVacuum)
+	}
+	base, params, _ := strings.Cut(dsn, "?")
+	dsn = c.withPragmas(base, "auto_vacuum="+strings.ToLower(c.autoVacuum))
+	if params != "" {
+		dsn += "&" + params
+	}
+	return dsn, nil
+}
+
+// Exclusive takes over the worker for the whole of fn: no other job runs until it returns, not even the readers of
+// WithReaders. Unlike a transaction, fn may run pragmas, ATTACH or VACUUM, in as many steps as it needs.
+// WithJobTimeout doesn't apply. Everything stalls while fn runs: keep it for maintenance.
+func (c *ComfyDB) Exclusive(fn func(db *sql.DB) error) error {
+	item := c.newWorkItem(withoutContext(func(db *sql.DB) (interface{}, error) {
+		c.exclusiveMu.Lock()
+		defer c.exclusiveMu.Unlock()
+		return nil, fn(db)
+	}))
+	item.timeout = 0
+	c.results.Store(item.id, item)
+	c.dispatch(item)
+
+	// however long it takes
+	<-item.done
+	c.results.Delete(item.id)
+	return item.err
+}
@@ -0,0 +1,160 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPreallocate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preallocate.db")
+	comfyMe, err := New(WithPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	const size = 4 << 20
+	if err := comfyMe.Preallocate(size); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() < size {
+		t.Fatalf("expected the file to be at least %d bytes, got %d", size, info.Size())
+	}
+
+	tables, err := comfyMe.ShowTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tables {
+		if table == "_comfy_preallocate" {
+			t.Fatal("expected the scratch table to be dropped")
+		}
+	}
+}
+
+func TestVacuum(t *testing.T) {
+	comfyMe, err := New(WithPath(filepath.Join(t.TempDir(), "vacuum.db")), WithAutoVacuum("incremental"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	mode, err := comfyMe.GetPragma("auto_vacuum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != "2" {
+		t.Fatalf("expected auto_vacuum INCREMENTAL (2), got %s", mode)
+	}
+
+	if _, err := comfyMe.Exec("CREATE TABLE bloated (data BLOB)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO bloated (data) VALUES (zeroblob(1 << 20))"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("DELETE FROM bloated"); err != nil {
+		t.Fatal(err)
+	}
+	freePages := func() string {
+		t.Helper()
+		count, err := comfyMe.GetPragma("freelist_count")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+	if freePages() == "0" {
+		t.Fatal("expected free pages after the delete")
+	}
+	if err := comfyMe.IncrementalVacuum(0); err != nil {
+		t.Fatal(err)
+	}
+	if count := freePages(); count != "0" {
+		t.Fatalf("expected no free page left, got %s", count)
+	}
+	if err := comfyMe.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := comfyMe.Vacuum(); err == nil {
+		t.Fatal("expected Vacuum to fail during a transaction")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(WithMemory(), WithAutoVacuum("sometimes")); err == nil {
+		t.Fatal("expected an invalid auto_vacuum mode to be rejected")
+	}
+}
+
+func TestExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exclusive.db")
+	comfyMe, err := New(WithPath(path), WithReaders(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if _, err := comfyMe.Exec("CREATE TABLE steps (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	inside := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- comfyMe.Exclusive(func(db *sql.DB) error {
+			close(inside)
+			<-release
+			if _, err := db.Exec("INSERT INTO steps VALUES ('exclusive')"); err != nil {
+				return err
+			}
+			_, err := db.Exec("VACUUM")
+			return err
+		})
+	}()
+	<-inside
+
+	readID := comfyMe.NewRead(func(db *sql.DB) (interface{}, error) {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM steps").Scan(&count)
+		return count, err
+	})
+	writeID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return db.Exec("INSERT INTO steps VALUES ('after')")
+	})
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := comfyMe.Result(readID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.(int) < 1 {
+		t.Fatalf("expected the read to wait for Exclusive, it saw %v rows", count)
+	}
+	if _, err := comfyMe.Result(writeID); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,120 @@
+//go:build cgo && !comfylite3_nomattn
+
+package comfylite3
+
+/*
+typedef struct sqlite3 sqlite3;
+void sqlite3_interrupt(sqlite3*);
+
+static void comfy_interrupt(void *db) {
+	sqlite3_interrupt((sqlite3*)db);
+}
+*/
+import "C"
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Raw connection of mattn/go-sqlite3, handed to the connect hooks.
+type rawConn = sqlite3.SQLiteConn
+
+// Is the database opened with mattn/go-sqlite3, the driver registered as "sqlite3" by this build.
+func (c *ComfyDB) mattn() bool {
+	return c.driver == "sqlite3"
+}
+
+// Connector used to open the worker's database so we can reach the raw sqlite3 connection.
+type sqliteConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (sc *sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return sc.driver.Open(sc.dsn)
+}
+
+func (sc *sqliteConnector) Driver() driver.Driver {
+	return sc.driver
+}
+
+// Open the underlying database, applying the connect hooks on every new connection.
+// The connection of the worker is kept for Interrupt.
+func (c *ComfyDB) open(dsn string, worker bool) (*sql.DB, error) {
+	if !c.mattn() {
+		return c.openDriver(dsn)
+	}
+	return sql.OpenDB(&sqliteConnector{
+		dsn: dsn,
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				c.connectHooksMu.RLock()
+				hooks := append([]connectHook(nil), c.connectHooks...)
+				c.connectHooksMu.RUnlock()
+				for _, hook := range hooks {
+					if err := hook(conn); err != nil {
+						return err
+					}
+				}
+				if worker {
+					c.workerConn.Store(conn)
+				}
+				return nil
+			},
+		},
+	}), nil
+}
+
+// Run fn with the raw sqlite3 connection behind db, from a job.
+func withRawConn(db *sql.DB, fn func(conn *rawConn) error) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("%w: not a sqlite3 connection", ErrUnsupported)
+		}
+		return fn(sqliteConn)
+	})
+}
+
+// Result codes of an error of mattn/go-sqlite3.
+func driverResultCode(err error) (primary int, extended int, ok bool) {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return 0, 0, false
+	}
+	return int(sqliteErr.Code), int(sqliteErr.ExtendedCode), true
+}
+
+// Handle of the connection, the sqlite3* held by the unexported db field of go-sqlite3.
+func rawHandle(conn *rawConn) (unsafe.Pointer, error) {
+	field := reflect.ValueOf(conn).Elem().FieldByName("db")
+	if !field.IsValid() || field.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("%w: no sqlite3 handle in this version of mattn/go-sqlite3", ErrUnsupported)
+	}
+	return *(*unsafe.Pointer)(unsafe.Pointer(field.UnsafeAddr())), nil
+}
+
+// Call sqlite3_interrupt on the handle of the connection, go-sqlite3 only does it for cancelled contexts.
+func interruptConn(conn *rawConn) error {
+	handle, err := rawHandle(conn)
+	if err != nil {
+		return err
+	}
+	if handle != nil {
+		C.comfy_interrupt(handle)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build cgo && !comfylite3_nomattn
+
+package comfylite3
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// Interrupt reaches the handle through an unexported field of go-sqlite3, which an upgrade could rename.
+func TestRawHandle(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/handle.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	id := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return nil, withRawConn(db, func(conn *rawConn) error {
+			handle, err := rawHandle(conn)
+			if err == nil && handle == nil {
+				t.Error("expected the handle of an open connection")
+			}
+			return err
+		})
+	})
+	if _, err := comfyMe.Result(id); err != nil {
+		t.Fatalf("expected the sqlite3 handle of the connection, got %v", err)
+	}
+}
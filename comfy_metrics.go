@@ -0,0 +1,116 @@
+package comfylite3
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Weight of the last job in the rolling averages.
+const metricsSmoothing = 0.1
+
+// Jobs the percentiles are computed over, the most recent ones.
+const metricsWindow = 1024
+
+// MetricsSnapshot is a point in time view of the worker.
+type MetricsSnapshot struct {
+	Pending          int64         // jobs queued and not started yet
+	Executed         uint64        // jobs the worker ran
+	Errors           uint64        // jobs that ended with an error
+	AverageDuration  time.Duration // exponential moving average of the execution time
+	P50Duration      time.Duration // median execution time of the last 1024 jobs
+	P95Duration      time.Duration
+	P99Duration      time.Duration
+	AverageQueueWait time.Duration // exponential moving average of the time spent queued before running
+	MaxQueueWait     time.Duration // longest time spent queued by one of the last 1024 jobs
+}
+
+// Counters maintained around the worker loop.
+type metrics struct {
+	pending  atomic.Int64
+	executed atomic.Uint64
+	errors   atomic.Uint64
+
+	mu        sync.Mutex // the readers record their jobs along with the worker
+	average   time.Duration
+	queueWait time.Duration
+	durations [metricsWindow]time.Duration
+	waits     [metricsWindow]time.Duration
+	samples   int // filled entries of the windows
+	next      int // entry the next job takes
+}
+
+// Account for a job that went through the worker after waiting in the queue.
+func (m *metrics) record(duration, wait time.Duration, failed bool) {
+	m.executed.Add(1)
+	if failed {
+		m.errors.Add(1)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.average = smooth(m.average, duration, m.samples == 0)
+	m.queueWait = smooth(m.queueWait, wait, m.samples == 0)
+	m.durations[m.next] = duration
+	m.waits[m.next] = wait
+	m.next = (m.next + 1) % metricsWindow
+	if m.samples < metricsWindow {
+		m.samples++
+	}
+}
+
+// Move an exponential moving average toward value.
+func smooth(average, value time.Duration, first bool) time.Duration {
+	if first {
+		return value
+	}
+	return average + time.Duration(metricsSmoothing*float64(value-average))
+}
+
+// Metrics returns a snapshot of the worker activity.
+// It never waits for the worker: it's safe from any goroutine, cheap enough to poll for a dashboard.
+func (c *ComfyDB) Metrics() MetricsSnapshot {
+	snapshot := MetricsSnapshot{
+		Pending:  c.metrics.pending.Load(),
+		Executed: c.metrics.executed.Load(),
+		Errors:   c.metrics.errors.Load(),
+	}
+	m := &c.metrics
+	m.mu.Lock()
+	snapshot.AverageDuration = m.average
+	snapshot.AverageQueueWait = m.queueWait
+	durations := append([]time.Duration(nil), m.durations[:m.samples]...)
+	for _, wait := range m.waits[:m.samples] {
+		if wait > snapshot.MaxQueueWait {
+			snapshot.MaxQueueWait = wait
+		}
+	}
+	m.mu.Unlock()
+
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		snapshot.P50Duration = percentile(durations, 50)
+		snapshot.P95Duration = percentile(durations, 95)
+		snapshot.P99Duration = percentile(durations, 99)
+	}
+	return snapshot
+}
+
+// Nearest-rank percentile p of sorted values.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// PublishExpvar publishes Metrics under name on the expvar page, /debug/vars, refreshed on every read.
+// Like expvar.Publish it panics when name is taken already: call it once per ComfyDB.
+// For Prometheus, read Metrics from GaugeFuncs or a collector of your own.
+func (c *ComfyDB) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return c.Metrics()
+	}))
+}
@@ -0,0 +1,82 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MigrationsFS reads the migrations of the SQL scripts of dir in fsys, an embed.FS typically,
+// to hand them to WithMigration or Migrate. Each migration is a pair of files named after its version and label,
+// `0001_create_users.up.sql` and `0001_create_users.down.sql`: the label is "create_users".
+// The scripts may hold several statements and run in the transaction of the migrations. Other files are ignored.
+func MigrationsFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case entry.IsDir():
+			continue
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, label, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseUint(prefix, 10, 0)
+		if !ok || err != nil || label == "" {
+			return nil, fmt.Errorf("invalid migration file name %q, expected <version>_<label>.%s.sql", name, direction)
+		}
+		script, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", name, err)
+		}
+
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Label: label}
+			byVersion[uint(version)] = migration
+		} else if migration.Label != label {
+			return nil, fmt.Errorf("conflicting migrations for version %v: %q and %q", version, migration.Label, label)
+		}
+		fn := scriptMigration(splitStatements(string(script)))
+		if direction == "up" {
+			migration.Up = fn
+		} else {
+			migration.Down = fn
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == nil || migration.Down == nil {
+			return nil, fmt.Errorf("migration %v %q needs both an up and a down script", migration.Version, migration.Label)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up or Down function running the statements of a script.
+func scriptMigration(statements []string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := execStatements(tx, statements)
+		return err
+	}
+}
@@ -0,0 +1,67 @@
+package comfylite3
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrationsFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0001_create_pets.up.sql":     {Data: []byte("CREATE TABLE pets (id INTEGER PRIMARY KEY);\nCREATE INDEX pets_id ON pets (id);")},
+		"migrations/0001_create_pets.down.sql":   {Data: []byte("DROP TABLE pets;")},
+		"migrations/0010_create_owners.up.sql":   {Data: []byte("CREATE TABLE owners (id INTEGER PRIMARY KEY, name TEXT DEFAULT 'a;b');")},
+		"migrations/0010_create_owners.down.sql": {Data: []byte("DROP TABLE owners;")},
+		"migrations/0002_add_pets_name.up.sql":   {Data: []byte("ALTER TABLE pets ADD COLUMN name TEXT;")},
+		"migrations/0002_add_pets_name.down.sql": {Data: []byte("ALTER TABLE pets DROP COLUMN name;")},
+		"migrations/README.md":                   {Data: []byte("ignored")},
+	}
+
+	migrations, err := MigrationsFS(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 3 || migrations[0].Version != 1 || migrations[1].Version != 2 || migrations[2].Version != 10 {
+		t.Fatalf("expected versions 1, 2 and 10 in order, got %v", migrations)
+	}
+	if migrations[1].Label != "add_pets_name" {
+		t.Fatalf("expected the label add_pets_name, got %q", migrations[1].Label)
+	}
+
+	comfyMe, err := New(WithPath(t.TempDir() + "/migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if err := comfyMe.Migrate(migrations); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := comfyMe.Version(); err != nil || version != 10 {
+		t.Fatalf("expected version 10, got %v %v", version, err)
+	}
+	if columns, err := comfyMe.ShowColumns("pets"); err != nil || len(columns) != 2 {
+		t.Fatalf("expected the pets columns to be migrated, got %v %v", columns, err)
+	}
+
+	if err := comfyMe.MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+	tables, err := comfyMe.ShowTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tables {
+		if table == "owners" {
+			t.Fatal("expected the owners table to be dropped")
+		}
+	}
+
+	missingDown := fstest.MapFS{"migrations/0001_create_pets.up.sql": {Data: []byte("CREATE TABLE pets (id INTEGER);")}}
+	if _, err := MigrationsFS(missingDown, "migrations"); err == nil {
+		t.Fatal("expected an error for a migration without down script")
+	}
+	invalid := fstest.MapFS{"migrations/create_pets.up.sql": {Data: []byte("CREATE TABLE pets (id INTEGER);")}}
+	if _, err := MigrationsFS(invalid, "migrations"); err == nil {
+		t.Fatal("expected an error for a file name without version")
+	}
+}
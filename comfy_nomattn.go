@@ -0,0 +1,77 @@
+//go:build !cgo || comfylite3_nomattn
+
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// Stand-in for the raw connection of mattn/go-sqlite3, left out of this build: open refuses the connect hooks
+// taking it, so none of its methods is ever called.
+type rawConn struct{}
+
+func (*rawConn) Exec(string, []driver.Value) (driver.Result, error) {
+	return nil, errNoMattn
+}
+
+func (*rawConn) Query(string, []driver.Value) (driver.Rows, error) {
+	return nil, errNoMattn
+}
+
+func (*rawConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return nil, errNoMattn
+}
+
+func (*rawConn) RegisterFunc(string, interface{}, bool) error {
+	return errNoMattn
+}
+
+func (*rawConn) RegisterAggregator(string, interface{}, bool) error {
+	return errNoMattn
+}
+
+func (*rawConn) RegisterUpdateHook(func(int, string, string, int64)) {}
+
+func (*rawConn) RegisterCommitHook(func() int) {}
+
+func (*rawConn) RegisterRollbackHook(func()) {}
+
+func (*rawConn) AutoCommit() bool {
+	return true
+}
+
+// Error of what needs mattn/go-sqlite3 in this build.
+var errNoMattn = fmt.Errorf("%w: built without mattn/go-sqlite3", ErrUnsupported)
+
+// Never mattn/go-sqlite3 in this build, whatever driver is registered as "sqlite3".
+func (c *ComfyDB) mattn() bool {
+	return false
+}
+
+// Open the underlying database with the driver of WithDriver.
+func (c *ComfyDB) open(dsn string, worker bool) (*sql.DB, error) {
+	return c.openDriver(dsn)
+}
+
+func withRawConn(db *sql.DB, fn func(conn *rawConn) error) error {
+	return errNoMattn
+}
+
+func driverResultCode(err error) (primary int, extended int, ok bool) {
+	return 0, 0, false
+}
+
+func interruptConn(conn *rawConn) error {
+	return errNoMattn
+}
+
+func (c *ComfyDB) backup(ctx context.Context, destPath string, progress func(remaining, total int)) error {
+	return errNoMattn
+}
+
+func (c *ComfyDB) restore(ctx context.Context, srcPath string) error {
+	return errNoMattn
+}
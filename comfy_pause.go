@@ -0,0 +1,28 @@
+package comfylite3
+
+// Pause holds the queue back, for a quiet window to copy or swap the database file or to VACUUM it.
+// It returns once the job of the worker and the ones of the readers are done: a transaction served through OpenDB
+// is let to finish first. The jobs submitted meanwhile are queued, as many as WithMaxQueue allows,
+// and run after Resume. Closing the database resumes it to drain the queue. Don't call it from a job, it would wait for itself.
+func (c *ComfyDB) Pause() {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.paused {
+		return
+	}
+	c.paused = true
+	c.queue.pause()
+	c.exclusiveMu.Lock()
+}
+
+// Resume lets the queue paused by Pause run again.
+func (c *ComfyDB) Resume() {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if !c.paused {
+		return
+	}
+	c.paused = false
+	c.exclusiveMu.Unlock()
+	c.queue.resume()
+}
@@ -0,0 +1,72 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir()+"/paused.db"), WithReaders(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	// Pause waits for the running job
+	started := make(chan struct{})
+	release := make(chan struct{})
+	comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+	paused := make(chan struct{})
+	go func() {
+		comfyMe.Pause()
+		close(paused)
+	}()
+	select {
+	case <-paused:
+		t.Fatal("expected Pause to wait for the running job")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-paused
+	comfyMe.Pause()
+
+	writeID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return "written", nil
+	})
+	readID := comfyMe.NewRead(func(db *sql.DB) (interface{}, error) {
+		return "read", nil
+	})
+	time.Sleep(20 * time.Millisecond)
+	for _, id := range []uint64{writeID, readID} {
+		if _, done, _ := comfyMe.Poll(id); done {
+			t.Fatal("expected the jobs to wait while paused")
+		}
+	}
+
+	comfyMe.Resume()
+	comfyMe.Resume()
+	if value, err := comfyMe.WaitForTimeout(writeID, 5*time.Second); err != nil || value != "written" {
+		t.Fatalf("expected the job to run after Resume, got %v %v", value, err)
+	}
+	if value, err := comfyMe.WaitForTimeout(readID, 5*time.Second); err != nil || value != "read" {
+		t.Fatalf("expected the read to run after Resume, got %v %v", value, err)
+	}
+
+	// Close drains a paused queue
+	comfyMe.Pause()
+	drainedID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return "drained", nil
+	})
+	if err := comfyMe.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if result := <-comfyMe.WaitForChn(drainedID); result != "drained" {
+		t.Fatalf("expected the queue to be drained, got %v", result)
+	}
+}
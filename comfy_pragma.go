@@ -0,0 +1,276 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type pragmaAccess int
+
+const (
+	pragmaRead pragmaAccess = 1 << iota
+	pragmaWrite
+)
+
+// Pragmas known to SQLite and whether they can be read, written or both.
+var knownPragmas = map[string]pragmaAccess{
+	"analysis_limit":            pragmaRead | pragmaWrite,
+	"application_id":            pragmaRead | pragmaWrite,
+	"auto_vacuum":               pragmaRead | pragmaWrite,
+	"automatic_index":           pragmaRead | pragmaWrite,
+	"busy_timeout":              pragmaRead | pragmaWrite,
+	"cache_size":                pragmaRead | pragmaWrite,
+	"cache_spill":               pragmaRead | pragmaWrite,
+	"case_sensitive_like":       pragmaWrite,
+	"cell_size_check":           pragmaRead | pragmaWrite,
+	"checkpoint_fullfsync":      pragmaRead | pragmaWrite,
+	"collation_list":            pragmaRead,
+	"compile_options":           pragmaRead,
+	"data_version":              pragmaRead,
+	"database_list":             pragmaRead,
+	"defer_foreign_keys":        pragmaRead | pragmaWrite,
+	"encoding":                  pragmaRead | pragmaWrite,
+	"foreign_key_check":         pragmaRead,
+	"foreign_keys":              pragmaRead | pragmaWrite,
+	"freelist_count":            pragmaRead,
+	"fullfsync":                 pragmaRead | pragmaWrite,
+	"function_list":             pragmaRead,
+	"hard_heap_limit":           pragmaRead | pragmaWrite,
+	"ignore_check_constraints":  pragmaRead | pragmaWrite,
+	"incremental_vacuum":        pragmaWrite,
+	"integrity_check":           pragmaRead,
+	"journal_mode":              pragmaRead | pragmaWrite,
+	"journal_size_limit":        pragmaRead | pragmaWrite,
+	"legacy_alter_table":        pragmaRead | pragmaWrite,
+	"locking_mode":              pragmaRead | pragmaWrite,
+	"max_page_count":            pragmaRead | pragmaWrite,
+	"mmap_size":                 pragmaRead | pragmaWrite,
+	"module_list":               pragmaRead,
+	"optimize":                  pragmaWrite,
+	"page_count":                pragmaRead,
+	"page_size":                 pragmaRead | pragmaWrite,
+	"pragma_list":               pragmaRead,
+	"query_only":                pragmaRead | pragmaWrite,
+	"quick_check":               pragmaRead,
+	"read_uncommitted":          pragmaRead | pragmaWrite,
+	"recursive_triggers":        pragmaRead | pragmaWrite,
+	"reverse_unordered_selects": pragmaRead | pragmaWrite,
+	"schema_version":            pragmaRead | pragmaWrite,
+	"secure_delete":             pragmaRead | pragmaWrite,
+	"shrink_memory":             pragmaWrite,
+	"soft_heap_limit":           pragmaRead | pragmaWrite,
+	"synchronous":               pragmaRead | pragmaWrite,
+	"temp_store":                pragmaRead | pragmaWrite,
+	"threads":                   pragmaRead | pragmaWrite,
+	"trusted_schema":            pragmaRead | pragmaWrite,
+	"user_version":              pragmaRead | pragmaWrite,
+	"wal_autocheckpoint":        pragmaRead | pragmaWrite,
+	"wal_checkpoint":            pragmaRead,
+	"writable_schema":           pragmaRead | pragmaWrite,
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate a pragma name, optionally prefixed by a schema (`aux.user_version`), and return it ready to be used in a statement.
+func pragmaName(name string, access pragmaAccess) (string, error) {
+	schema := ""
+	pragma := strings.ToLower(strings.TrimSpace(name))
+	if idx := strings.Index(pragma, "."); idx >= 0 {
+		schema, pragma = pragma[:idx], pragma[idx+1:]
+		if !identifierPattern.MatchString(schema) {
+			return "", fmt.Errorf("invalid schema name %q for pragma %q", schema, name)
+		}
+	}
+	allowed, ok := knownPragmas[pragma]
+	if !ok {
+		return "", fmt.Errorf("unknown pragma %q", name)
+	}
+	if allowed&access == 0 {
+		if access == pragmaRead {
+			return "", fmt.Errorf("pragma %q is write-only", name)
+		}
+		return "", fmt.Errorf("pragma %q is read-only", name)
+	}
+	if schema != "" {
+		return fmt.Sprintf("%q.%s", schema, pragma), nil
+	}
+	return pragma, nil
+}
+
+// Format a value as a pragma literal, pragmas don't accept bind parameters.
+func pragmaValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return pragmaValue(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("invalid pragma value %v", v)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	default:
+		return "", fmt.Errorf("unsupported pragma value type %T", value)
+	}
+}
+
+// SetPragma runs `PRAGMA name=value` on the worker.
+// The name is validated against the pragmas known to SQLite and the value is quoted safely.
+func (c *ComfyDB) SetPragma(name string, value interface{}) error {
+	pragma, err := pragmaName(name, pragmaWrite)
+	if err != nil {
+		return err
+	}
+	literal, err := pragmaValue(value)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("PRAGMA %s=%s", pragma, literal)
+	pragmaID := c.New(func(db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, nil)
+		_, err := db.Exec(query)
+		return nil, err
+	})
+	result, err := c.await(pragmaID)
+	if err != nil {
+		return err
+	}
+	if errResult, ok := result.(error); ok {
+		return errResult
+	}
+	c.rememberPragma(pragma, query)
+	return nil
+}
+
+// Turn the foreign keys on for the WithForeignKeys of OpenDB, with a warning when it fails.
+func (c *ComfyDB) enableForeignKeys() {
+	if err := c.SetPragma("foreign_keys", true); err != nil {
+		c.echof("-- error setting foreign_keys pragma: %v", err)
+		c.warnings().Warn("comfylite3: setting the foreign_keys pragma failed", "error", err)
+	}
+}
+
+// Keep the last statement setting each pragma, for Reopen.
+func (c *ComfyDB) rememberPragma(pragma, query string) {
+	c.pragmasMu.Lock()
+	defer c.pragmasMu.Unlock()
+	prefix := fmt.Sprintf("PRAGMA %s=", pragma)
+	kept := c.pragmas[:0]
+	for _, statement := range c.pragmas {
+		if !strings.HasPrefix(statement, prefix) {
+			kept = append(kept, statement)
+		}
+	}
+	c.pragmas = append(kept, query)
+}
+
+// GetPragma runs `PRAGMA name` on the worker and returns the first column of the first row.
+func (c *ComfyDB) GetPragma(name string) (string, error) {
+	pragma, err := pragmaName(name, pragmaRead)
+	if err != nil {
+		return "", err
+	}
+	query := fmt.Sprintf("PRAGMA %s", pragma)
+	pragmaID := c.New(func(db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, nil)
+		var value interface{}
+		if err := db.QueryRow(query).Scan(&value); err != nil {
+			if err == sql.ErrNoRows {
+				return "", nil
+			}
+			return nil, err
+		}
+		switch v := value.(type) {
+		case nil:
+			return "", nil
+		case []byte:
+			return string(v), nil
+		default:
+			return fmt.Sprint(v), nil
+		}
+	})
+	result, err := c.await(pragmaID)
+	if err != nil {
+		return "", err
+	}
+	switch value := result.(type) {
+	case string:
+		return value, nil
+	case error:
+		return "", value
+	default:
+		return "", fmt.Errorf("unexpected type")
+	}
+}
+
+// Read an integer pragma.
+func (c *ComfyDB) intPragma(name string) (int, error) {
+	value, err := c.GetPragma(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("pragma %q is not an integer: %q", name, value)
+	}
+	return n, nil
+}
+
+// UserVersion returns `PRAGMA user_version`, an integer free for the application to use, to version its schema for instance.
+func (c *ComfyDB) UserVersion() (int, error) {
+	return c.intPragma("user_version")
+}
+
+// SetUserVersion sets `PRAGMA user_version`, see UserVersion.
+func (c *ComfyDB) SetUserVersion(version int) error {
+	return c.SetPragma("user_version", version)
+}
+
+// CacheSize returns `PRAGMA cache_size`: a number of pages when positive, of KiB when negative.
+func (c *ComfyDB) CacheSize() (int, error) {
+	return c.intPragma("cache_size")
+}
+
+// BusyTimeout returns `PRAGMA busy_timeout` of the worker connection, see WithBusyTimeout.
+func (c *ComfyDB) BusyTimeout() (time.Duration, error) {
+	ms, err := c.intPragma("busy_timeout")
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// PageSize returns `PRAGMA page_size` in bytes.
+func (c *ComfyDB) PageSize() (int, error) {
+	return c.intPragma("page_size")
+}
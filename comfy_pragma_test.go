@@ -0,0 +1,216 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPragma(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if err := comfyMe.SetPragma("user_version", 42); err != nil {
+		t.Fatal(err)
+	}
+	version, err := comfyMe.GetPragma("user_version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "42" {
+		t.Fatalf("expected user_version 42, got %s", version)
+	}
+
+	if err := comfyMe.SetPragma("main.cache_size", -2000); err != nil {
+		t.Fatal(err)
+	}
+	cacheSize, err := comfyMe.GetPragma("main.cache_size")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cacheSize != "-2000" {
+		t.Fatalf("expected cache_size -2000, got %s", cacheSize)
+	}
+
+	if err := comfyMe.SetPragma("user_versoin", 1); err == nil {
+		t.Fatal("expected an error for an unknown pragma")
+	}
+	if err := comfyMe.SetPragma("page_count", 1); err == nil {
+		t.Fatal("expected an error for a read-only pragma")
+	}
+	if _, err := comfyMe.GetPragma("optimize"); err == nil {
+		t.Fatal("expected an error for a write-only pragma")
+	}
+	if err := comfyMe.SetPragma("journal_mode", "memory'; DROP TABLE _migrations; --"); err != nil {
+		t.Fatal(err)
+	}
+	tables, err := comfyMe.ShowTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, table := range tables {
+		if table == "_migrations" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected the pragma value to be quoted")
+	}
+}
+
+func TestUserVersion(t *testing.T) {
+	comfyMe, err := New(WithPath(filepath.Join(t.TempDir(), "versioned.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	version, err := comfyMe.UserVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 {
+		t.Fatalf("expected a fresh database at version 0, got %d", version)
+	}
+	if err := comfyMe.SetUserVersion(7); err != nil {
+		t.Fatal(err)
+	}
+	if version, err = comfyMe.UserVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if version != 7 {
+		t.Fatalf("expected version 7, got %d", version)
+	}
+
+	pageSize, err := comfyMe.PageSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pageSize <= 0 {
+		t.Fatalf("expected a page size, got %d", pageSize)
+	}
+	if _, err := comfyMe.CacheSize(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBusyTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "busy.db")
+	holder, err := New(WithPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	if _, err := holder.Exec("CREATE TABLE busy (n INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// another process, as far as SQLite is concerned: its own connection without the shared cache
+	impatient, err := New(WithDSN("file:"+path+"?mode=rw"), WithBusyTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer impatient.Close()
+	patient, err := New(WithDSN("file:"+path+"?mode=rw"), WithBusyTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer patient.Close()
+
+	if timeout, err := impatient.BusyTimeout(); err != nil || timeout != 50*time.Millisecond {
+		t.Fatalf("expected a busy timeout of 50ms, got %v, %v", timeout, err)
+	}
+
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	held := make(chan error, 1)
+	go func() {
+		held <- holder.Exclusive(func(db *sql.DB) error {
+			if _, err := db.Exec("BEGIN IMMEDIATE"); err != nil {
+				close(locked)
+				return err
+			}
+			close(locked)
+			<-release
+			_, err := db.Exec("COMMIT")
+			return err
+		})
+	}()
+	<-locked
+
+	start := time.Now()
+	if _, err := impatient.Exec("INSERT INTO busy (n) VALUES (1)"); !IsBusy(err) {
+		t.Fatalf("expected SQLITE_BUSY, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("expected to give up after the busy timeout, took %v", elapsed)
+	}
+
+	time.AfterFunc(100*time.Millisecond, func() { close(release) })
+	if _, err := patient.Exec("INSERT INTO busy (n) VALUES (2)"); err != nil {
+		t.Fatalf("expected to wait for the lock, got %v", err)
+	}
+	if err := <-held; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPragmaOptions(t *testing.T) {
+	comfyMe, err := New(
+		WithPath(filepath.Join(t.TempDir(), "pragmas.db")),
+		WithReaders(2),
+		WithCacheSize(-4000),
+		WithTempStore("memory"),
+		WithMmapSize(1<<20),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	for pragma, want := range map[string]string{"cache_size": "-4000", "temp_store": "2", "mmap_size": "1048576"} {
+		if value, err := comfyMe.GetPragma(pragma); err != nil || value != want {
+			t.Fatalf("expected %s %s on the worker, got %s %v", pragma, want, value, err)
+		}
+		readID := comfyMe.NewRead(func(db *sql.DB) (interface{}, error) {
+			var value string
+			err := db.QueryRow("PRAGMA " + pragma).Scan(&value)
+			return value, err
+		})
+		if value, err := comfyMe.Result(readID); err != nil || value != want {
+			t.Fatalf("expected %s %s on the readers, got %v %v", pragma, want, value, err)
+		}
+	}
+
+	if _, err := New(WithMemory(), WithTempStore("disk")); err == nil {
+		t.Fatal("expected an error for an invalid temp_store mode")
+	}
+	if _, err := New(WithMemory(), WithMmapSize(-1)); err == nil {
+		t.Fatal("expected an error for a negative mmap size")
+	}
+}
+
+func TestOpenDBForeignKeysReopen(t *testing.T) {
+	comfyMe, err := New(WithPath(filepath.Join(t.TempDir(), "fk.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe, WithForeignKeys())
+	db.Close()
+	if err := comfyMe.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := comfyMe.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := comfyMe.GetPragma("foreign_keys"); err != nil || value != "1" {
+		t.Fatalf("expected the foreign keys to stay on after Reopen, got %s %v", value, err)
+	}
+}
@@ -0,0 +1,208 @@
+package comfylite3
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Times in a row the oldest queued job can be overtaken by jobs of higher priority before it's served anyway.
+const maxOvertakes = 32
+
+// Job waiting in the queue.
+type queued struct {
+	item  *workItem
+	seq   uint64 // submission order
+	taken bool   // popped through the other view of the queue
+}
+
+// Queued jobs by priority, then by submission order.
+type priorityHeap []*queued
+
+func (h priorityHeap) Len() int { return len(h) }
+
+func (h priorityHeap) Less(i, j int) bool {
+	if h[i].item.priority != h[j].item.priority {
+		return h[i].item.priority > h[j].item.priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h priorityHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *priorityHeap) Push(x interface{}) { *h = append(*h, x.(*queued)) }
+
+func (h *priorityHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return last
+}
+
+// Queue feeding the worker: highest priority first, FIFO within a priority.
+// Jobs are kept both in a heap and in submission order, so the oldest one can be served when it starved too long.
+type jobQueue struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	byPrio    priorityHeap
+	fifo      []*queued
+	seq       uint64
+	overtakes int
+	closed    bool
+	paused    bool       // Pause holds the jobs back
+	idle      bool       // the worker waits for a job
+	idleCond  *sync.Cond // signaled when the worker becomes idle
+}
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	q.idleCond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Enqueue a job and wake the worker.
+func (q *jobQueue) push(item *workItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	job := &queued{item: item, seq: q.seq}
+	heap.Push(&q.byPrio, job)
+	q.fifo = append(q.fifo, job)
+	q.cond.Signal()
+}
+
+// Wait for the next job, false once the queue is closed and empty.
+func (q *jobQueue) pop() (*workItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		q.dropTaken()
+		if len(q.fifo) > 0 && !q.paused {
+			break
+		}
+		if q.closed && len(q.fifo) == 0 {
+			return nil, false
+		}
+		q.idle = true
+		q.idleCond.Broadcast()
+		q.cond.Wait()
+		q.idle = false
+	}
+	job := q.next()
+	q.take(job)
+	return job.item, true
+}
+
+// Next job if it can join the group of WithGroupCommit being built, waiting for one until deadline.
+// False when none came in time or the next one can't join the group: it stays queued.
+func (q *jobQueue) popGroup(deadline time.Time) (*workItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		q.dropTaken()
+		if q.paused {
+			return nil, false
+		}
+		if len(q.fifo) > 0 {
+			job := q.next()
+			if !job.item.group {
+				return nil, false
+			}
+			q.take(job)
+			return job.item, true
+		}
+		wait := time.Until(deadline)
+		if q.closed || wait <= 0 {
+			return nil, false
+		}
+		if timer == nil {
+			timer = time.AfterFunc(wait, func() {
+				q.mu.Lock()
+				defer q.mu.Unlock()
+				q.cond.Broadcast()
+			})
+		}
+		q.cond.Wait()
+	}
+}
+
+// Take a job out of the queue, false when it's not queued anymore.
+func (q *jobQueue) remove(item *workItem) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range q.fifo {
+		if job.item == item && !job.taken {
+			// skipped from now on, like the jobs taken through the other view
+			job.taken = true
+			return true
+		}
+	}
+	return false
+}
+
+// Drop what was already taken through the heap.
+func (q *jobQueue) dropTaken() {
+	for len(q.fifo) > 0 && q.fifo[0].taken {
+		q.fifo[0] = nil
+		q.fifo = q.fifo[1:]
+	}
+}
+
+// The job to serve next, the queue not being empty.
+func (q *jobQueue) next() *queued {
+	if q.overtakes >= maxOvertakes {
+		return q.fifo[0]
+	}
+	// skip what was already taken as the oldest
+	for q.byPrio[0].taken {
+		heap.Pop(&q.byPrio)
+	}
+	return q.byPrio[0]
+}
+
+// Hand out the job returned by next.
+func (q *jobQueue) take(job *queued) {
+	if len(q.byPrio) > 0 && q.byPrio[0] == job {
+		heap.Pop(&q.byPrio)
+	}
+	job.taken = true
+	if job == q.fifo[0] {
+		q.overtakes = 0
+	} else {
+		q.overtakes++
+	}
+}
+
+// Let the worker stop once the queued jobs are handed out.
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// Hold the jobs back and wait for the worker to be done with the one it runs, if any.
+func (q *jobQueue) pause() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = true
+	for !q.idle && !q.closed {
+		q.idleCond.Wait()
+	}
+}
+
+// Hand out the jobs again.
+func (q *jobQueue) resume() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = false
+	q.cond.Broadcast()
+}
@@ -0,0 +1,401 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPriority(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	release := make(chan struct{})
+	blockingID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	var mu sync.Mutex
+	order := []string{}
+	record := func(name string) SqlFn {
+		return func(db *sql.DB) (interface{}, error) {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil, nil
+		}
+	}
+	ids := []uint64{
+		comfyMe.New(record("low1")),
+		comfyMe.New(record("low2")),
+		comfyMe.NewWithPriority(10, record("high")),
+		comfyMe.NewWithPriority(5, record("medium")),
+	}
+	close(release)
+	comfyMe.WaitFor(blockingID)
+	for _, id := range ids {
+		if _, err := comfyMe.Result(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{"high", "medium", "low1", "low2"}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, order)
+		}
+	}
+}
+
+func TestContextWithPriority(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blockingID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	defer comfyMe.Forget(blockingID)
+	<-started
+
+	var mu sync.Mutex
+	order := []string{}
+	record := func(name string) SqlFn {
+		return func(db *sql.DB) (interface{}, error) {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil, nil
+		}
+	}
+	ids := []uint64{
+		comfyMe.New(record("low")),
+		comfyMe.NewContext(ContextWithPriority(context.Background(), 10), record("high")),
+	}
+	close(release)
+	for _, id := range ids {
+		if _, err := comfyMe.Result(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(order, ",") != "high,low" {
+		t.Fatalf("expected the job of the context to overtake, got %v", order)
+	}
+}
+
+func TestPriorityStarvation(t *testing.T) {
+	q := newJobQueue()
+	low := &workItem{id: 1}
+	q.push(low)
+	for i := 0; i < 100; i++ {
+		q.push(&workItem{id: uint64(i + 2), priority: 1})
+	}
+
+	seen := map[uint64]bool{}
+	for served := 1; ; served++ {
+		item, _ := q.pop()
+		seen[item.id] = true
+		if item == low {
+			if served != maxOvertakes+1 {
+				t.Fatalf("expected the low priority job after %d overtakes, served at %d", maxOvertakes, served)
+			}
+			break
+		}
+		if served > maxOvertakes+1 {
+			t.Fatal("expected the low priority job not to starve")
+		}
+	}
+
+	// every job is handed out exactly once
+	q.close()
+	for {
+		item, ok := q.pop()
+		if !ok {
+			break
+		}
+		if seen[item.id] {
+			t.Fatalf("job %d handed out twice", item.id)
+		}
+		seen[item.id] = true
+	}
+	if len(seen) != 101 {
+		t.Fatalf("expected 101 jobs, got %d", len(seen))
+	}
+}
+
+func TestMaxQueue(t *testing.T) {
+	comfyMe, err := New(WithMemory(), WithMaxQueue(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blockerID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+
+	queued := []uint64{}
+	for i := 0; i < 2; i++ {
+		id, err := comfyMe.TryNew(func(db *sql.DB) (interface{}, error) {
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		queued = append(queued, id)
+	}
+	if _, err := comfyMe.TryNew(func(db *sql.DB) (interface{}, error) {
+		return nil, nil
+	}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	submitted := make(chan uint64)
+	go func() {
+		submitted <- comfyMe.New(func(db *sql.DB) (interface{}, error) {
+			return "last", nil
+		})
+	}()
+	select {
+	case <-submitted:
+		t.Fatal("expected New to block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	lastID := <-submitted
+	for _, id := range append([]uint64{blockerID}, queued...) {
+		if _, err := comfyMe.Result(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value, err := comfyMe.Result(lastID); err != nil || value != "last" {
+		t.Fatalf("expected the blocked job to run, got %v, %v", value, err)
+	}
+}
+
+func TestQueueSize(t *testing.T) {
+	comfyMe := &ComfyDB{}
+	WithQueueSize(3)(comfyMe)
+	if cap(comfyMe.slots) != 3 {
+		t.Fatalf("expected a queue of 3, got %d", cap(comfyMe.slots))
+	}
+}
+
+func TestCancelLeavesQueue(t *testing.T) {
+	comfyMe, err := New(WithMemory(), WithMaxQueue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blockerID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+	ctx, cancel := context.WithCancel(context.Background())
+	queuedID := comfyMe.NewContext(ctx, func(db *sql.DB) (interface{}, error) { return nil, nil })
+	if _, err := comfyMe.TryNew(func(db *sql.DB) (interface{}, error) { return nil, nil }); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	// the place is given back without waiting for the worker
+	cancel()
+	if _, err := comfyMe.Result(queuedID); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	nextID, err := comfyMe.TryNew(func(db *sql.DB) (interface{}, error) { return "next", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !comfyMe.Cancel(nextID) {
+		t.Fatal("expected the queued job to be cancelled")
+	}
+	if pending := comfyMe.Metrics().Pending; pending != 0 {
+		t.Fatalf("expected no pending job, got %d", pending)
+	}
+	lastID, err := comfyMe.TryNew(func(db *sql.DB) (interface{}, error) { return "last", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	close(release)
+	if _, err := comfyMe.Result(blockerID); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := comfyMe.Result(lastID); err != nil || value != "last" {
+		t.Fatalf("expected the last job to run, got %v %v", value, err)
+	}
+	if _, err := comfyMe.Result(nextID); !errors.Is(err, ErrCanceled) {
+		t.Fatalf("expected ErrCanceled, got %v", err)
+	}
+}
+
+func TestRejectWhenFull(t *testing.T) {
+	var rejected []uint64
+	comfyMe, err := New(WithMemory(), WithMaxQueue(2), WithRejectWhenFull(func(workID uint64) {
+		rejected = append(rejected, workID)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blockerID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+	queued := []uint64{
+		comfyMe.New(func(db *sql.DB) (interface{}, error) { return nil, nil }),
+		comfyMe.New(func(db *sql.DB) (interface{}, error) { return nil, nil }),
+	}
+
+	// neither blocks
+	droppedID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return "ran", nil
+	})
+	if _, err := comfyMe.Result(droppedID); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	if _, err := comfyMe.ExecContext(context.Background(), "SELECT 1"); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	// a rejected QueryRow still gives a row to Scan
+	var n int
+	if err := comfyMe.QueryRow("SELECT 1").Scan(&n); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull from Scan, got %v", err)
+	}
+	if len(rejected) != 3 || rejected[0] != droppedID {
+		t.Fatalf("expected the three rejected jobs to be reported, got %v", rejected)
+	}
+
+	close(release)
+	for _, id := range append([]uint64{blockerID}, queued...) {
+		if _, err := comfyMe.Result(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := comfyMe.Exec("SELECT 1"); err != nil {
+		t.Fatalf("expected room in the queue again, got %v", err)
+	}
+}
+
+func TestSubmissionOrder(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	// the goroutines hand over to each other: every submission happens after the previous one returned
+	order := []int{}
+	turn := make(chan int)
+	done := make(chan struct{})
+	var last uint64
+	for g := 0; g < 4; g++ {
+		go func() {
+			for i := range turn {
+				i := i
+				last = comfyMe.New(func(db *sql.DB) (interface{}, error) {
+					order = append(order, i)
+					return nil, nil
+				})
+				if i == 999 {
+					close(done)
+					continue
+				}
+				turn <- i + 1
+			}
+		}()
+	}
+	turn <- 0
+	<-done
+	close(turn)
+	if _, err := comfyMe.WaitFor(last); err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range order {
+		if i != n {
+			t.Fatalf("expected the jobs to run in submission order, got %d at %d", n, i)
+		}
+	}
+	if len(order) != 1000 {
+		t.Fatalf("expected 1000 jobs, got %d", len(order))
+	}
+}
+
+func TestNewAfter(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir()+"/after.db"), WithReaders(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	var mu sync.Mutex
+	order := []string{}
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, name)
+	}
+
+	release := make(chan struct{})
+	readID := comfyMe.NewRead(func(db *sql.DB) (interface{}, error) {
+		<-release
+		record("read")
+		return nil, errors.New("read failed")
+	})
+	afterID := comfyMe.NewAfter(readID, func(db *sql.DB) (interface{}, error) {
+		record("after")
+		return nil, nil
+	})
+	otherID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		record("other")
+		return nil, nil
+	})
+	if _, err := comfyMe.WaitFor(otherID); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if _, err := comfyMe.WaitFor(afterID); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(order, ","); got != "other,read,after" {
+		t.Fatalf("expected the job to wait for its dependency, got %s", got)
+	}
+
+	unknownID := comfyMe.NewAfter(0, func(db *sql.DB) (interface{}, error) {
+		return "ran", nil
+	})
+	if result, err := comfyMe.WaitFor(unknownID); err != nil || result != "ran" {
+		t.Fatalf("expected an unknown dependency not to hold the job back, got %v %v", result, err)
+	}
+}
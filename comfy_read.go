@@ -0,0 +1,136 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Connection string of the read-only connections, without shared cache so they don't take table locks against the worker.
+const readerConn = "file:%s?mode=ro"
+
+// Connection string of the read-only connections to a named in-memory database, query_only added by readerDSN.
+const readerMemoryConn = "file:%s?mode=memory&cache=shared"
+
+// WithReaders opens `n` read-only connections next to the worker to run the jobs of NewRead in parallel.
+// It requires a database file (WithPath) or a named in-memory database (WithSharedMemory):
+// WithMemory and custom connection strings run NewRead on the worker.
+// The database file uses WAL, so the readers don't block the writes of the worker, nor the other way around.
+func WithReaders(n int) ComfyOption {
+	return func(c *ComfyDB) {
+		c.readers = n
+	}
+}
+
+// WithReadPool opens n read-only connections like WithReaders, and also runs the SELECT statements of Query,
+// QueryRow and their Context variants on them, concurrently with the worker. Other statements stay on the worker.
+// Like NewRead, such a query sees the last committed state, not the writes still queued on the worker.
+func WithReadPool(n int) ComfyOption {
+	return func(c *ComfyDB) {
+		c.readers = n
+		c.readPool = true
+	}
+}
+
+// WithReadReplica runs the jobs of NewRead on a read-only connection to the SQLite file at `path`
+// rather than on the worker: the database file itself, opened a second time,
+// or a WAL-mode copy kept up to date by another process.
+// Combine it with WithReaders to open more than one connection to the replica.
+//
+// NewRead never waits for the worker then and sees the last transaction committed to the replica's WAL.
+// A read starting right after a commit of the worker may not see it yet: SQLite only
+// picks the WAL up when the read transaction starts, and a copy lags behind as much as its replication does.
+// Wait for the write's result before reading when you need to read your own writes.
+func WithReadReplica(path string) ComfyOption {
+	return func(c *ComfyDB) {
+		c.replica = path
+	}
+}
+
+// Open the read-only connections of WithReaders or WithReadReplica.
+func (c *ComfyDB) openReaders() error {
+	var dsn string
+	switch {
+	case c.replica != "":
+		if c.readers <= 0 {
+			c.readers = 1
+		}
+		dsn = c.withPragmas(fmt.Sprintf(readerConn, c.replica), busyTimeoutPragma)
+	case c.readers <= 0:
+		return nil
+	default:
+		var ok bool
+		if dsn, ok = c.readerDSN(); !ok {
+			return nil
+		}
+	}
+	readDB, err := c.open(dsn, false)
+	if err != nil {
+		return fmt.Errorf("failed to open readers: %w", err)
+	}
+	if c.replica != "" {
+		// mode=ro opens lazily, a missing replica would only fail the first read
+		if err := readDB.Ping(); err != nil {
+			readDB.Close()
+			return fmt.Errorf("failed to open the read replica %q: %w", c.replica, err)
+		}
+	}
+	readDB.SetMaxOpenConns(c.readers)
+	readDB.SetMaxIdleConns(c.readers)
+	c.readDB = readDB
+	return nil
+}
+
+// Connection string of a read-only connection to the database of the worker,
+// none for a private in-memory database or a connection string of your own.
+func (c *ComfyDB) readerDSN() (string, bool) {
+	switch {
+	case c.sharedMemory != "":
+		return c.withPragmas(fmt.Sprintf(readerMemoryConn, c.sharedMemory), "query_only=true", busyTimeoutPragma), true
+	case c.memory || c.conn != "" || c.dsn != "":
+		return "", false
+	default:
+		return c.withPragmas(fmt.Sprintf(readerConn, c.path), busyTimeoutPragma), true
+	}
+}
+
+// OpenReadDB opens a pooled, read-only *sql.DB on the database of comfy, bypassing the queue:
+// reporting or dashboard queries run on it without waiting for the worker, while the writes keep going through comfy.
+// Use it with WAL mode so the readers don't block the writer. The connections are read-only like the ones of NewRead
+// and see the last committed state. It fails for a private in-memory database or one of WithConnection or WithDSN.
+// Close it before comfy.
+func OpenReadDB(comfy *ComfyDB) (*sql.DB, error) {
+	dsn, ok := comfy.readerDSN()
+	if !ok {
+		return nil, fmt.Errorf("can't open a read database on a private in-memory database or a connection string")
+	}
+	readDB, err := comfy.open(dsn, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the read database: %w", err)
+	}
+	return readDB, nil
+}
+
+// NewRead adds a read-only SQL function to be executed on one of the readers of WithReaders,
+// concurrently with the worker and the other readers. Wait for it like any other job: WaitFor, Result or WaitForChn.
+//
+// The function must only read: writing fails with "attempt to write a readonly database".
+// A reader sees the last committed state, not the writes queued on the worker before the call.
+// Without readers or a read replica it runs on the worker like New.
+func (c *ComfyDB) NewRead(fn SqlFn) uint64 {
+	item := c.newWorkItem(withoutContext(fn))
+	item.read = c.readDB != nil
+
+	c.results.Store(item.id, item)
+
+	c.dispatch(item)
+
+	return item.id
+}
+
+// Submit a query of Query or QueryRow bound to ctx: on the readers of WithReadPool when it's a SELECT, on the worker otherwise.
+func (c *ComfyDB) submitQuery(ctx context.Context, query string, fn SqlContextFn) uint64 {
+	item := c.newWorkItem(fn)
+	item.read = c.readPool && c.readDB != nil && firstKeyword(query) == "SELECT"
+	return c.submitContext(ctx, item)
+}
@@ -0,0 +1,245 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReaders(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir()+"/readers.db"), WithReaders(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	setupID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		if _, err := db.Exec("CREATE TABLE readers (id INTEGER PRIMARY KEY)"); err != nil {
+			return nil, err
+		}
+		return db.Exec("INSERT INTO readers (id) VALUES (1), (2), (3)")
+	})
+	if _, err := comfyMe.Result(setupID); err != nil {
+		t.Fatal(err)
+	}
+
+	// four slow reads take the time of one when they run in parallel
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readID := comfyMe.NewRead(func(db *sql.DB) (interface{}, error) {
+				var count int
+				if err := db.QueryRow("SELECT COUNT(*) FROM readers").Scan(&count); err != nil {
+					return nil, err
+				}
+				time.Sleep(200 * time.Millisecond)
+				return count, nil
+			})
+			count, err := comfyMe.Result(readID)
+			if err != nil || count != 3 {
+				t.Errorf("expected 3 rows, got %v %v", count, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > 600*time.Millisecond {
+		t.Fatalf("expected the reads to run in parallel, took %v", elapsed)
+	}
+
+	writeID := comfyMe.NewRead(func(db *sql.DB) (interface{}, error) {
+		return db.Exec("INSERT INTO readers (id) VALUES (4)")
+	})
+	if _, err := comfyMe.Result(writeID); err == nil || !strings.Contains(err.Error(), "readonly") {
+		t.Fatalf("expected a read-only error, got %v", err)
+	}
+}
+
+func TestReadersMemoryFallback(t *testing.T) {
+	comfyMe, err := New(WithMemory(), WithReaders(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	readID := comfyMe.NewRead(func(db *sql.DB) (interface{}, error) {
+		var one int
+		err := db.QueryRow("SELECT 1").Scan(&one)
+		return one, err
+	})
+	if value, err := comfyMe.Result(readID); err != nil || value != 1 {
+		t.Fatalf("expected 1, got %v %v", value, err)
+	}
+}
+
+func TestReadersSharedMemory(t *testing.T) {
+	comfyMe, err := New(WithSharedMemory("comfy_readers_shared"), WithReaders(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	writeID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		if _, err := db.Exec("CREATE TABLE IF NOT EXISTS shared_pets (name TEXT)"); err != nil {
+			return nil, err
+		}
+		return db.Exec("INSERT INTO shared_pets VALUES ('rex')")
+	})
+	if _, err := comfyMe.Result(writeID); err != nil {
+		t.Fatal(err)
+	}
+
+	readID := comfyMe.NewRead(func(db *sql.DB) (interface{}, error) {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM shared_pets").Scan(&count)
+		return count, err
+	})
+	if count, err := comfyMe.Result(readID); err != nil || count != 1 {
+		t.Fatalf("expected the reader to see the row of the worker, got %v %v", count, err)
+	}
+
+	writeFromReaderID := comfyMe.NewRead(func(db *sql.DB) (interface{}, error) {
+		return db.Exec("INSERT INTO shared_pets VALUES ('felix')")
+	})
+	if _, err := comfyMe.Result(writeFromReaderID); err == nil {
+		t.Fatal("expected the reader to be read-only")
+	}
+}
+
+func TestReadReplica(t *testing.T) {
+	path := t.TempDir() + "/replica.db"
+	comfyMe, err := New(WithPath(path), WithReadReplica(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if _, err := comfyMe.Exec("CREATE TABLE replicated (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO replicated (id) VALUES (1), (2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the worker is busy until the read is done
+	release := make(chan struct{})
+	blockID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	defer comfyMe.Forget(blockID)
+	defer close(release)
+
+	readID := comfyMe.NewRead(func(db *sql.DB) (interface{}, error) {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM replicated").Scan(&count)
+		return count, err
+	})
+	select {
+	case result := <-comfyMe.WaitForChn(readID):
+		if result != 2 {
+			t.Fatalf("expected the replica to see 2 committed rows, got %v", result)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the read not to wait for the worker")
+	}
+}
+
+func TestReadReplicaMissing(t *testing.T) {
+	_, err := New(WithMemory(), WithReadReplica(t.TempDir()+"/missing.db"))
+	if err == nil || !strings.Contains(err.Error(), "read replica") {
+		t.Fatalf("expected an error for a missing replica, got %v", err)
+	}
+}
+
+func TestReadPool(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir()+"/pool.db"), WithWAL(), WithReadPool(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if err := comfyMe.ExecScript("CREATE TABLE pooled (id INTEGER PRIMARY KEY); INSERT INTO pooled VALUES (1), (2);"); err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	blockingID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	defer comfyMe.Forget(blockingID)
+
+	// the SELECT statements don't wait for the busy worker
+	var count int
+	if err := comfyMe.QueryRow("SELECT COUNT(*) FROM pooled").Scan(&count); err != nil || count != 2 {
+		t.Fatalf("expected 2 rows, got %d %v", count, err)
+	}
+	rows, err := comfyMe.Query("SELECT id FROM pooled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	// the others do
+	inserted := make(chan error, 1)
+	go func() {
+		var id int
+		inserted <- comfyMe.QueryRow("INSERT INTO pooled VALUES (3) RETURNING id").Scan(&id)
+	}()
+	select {
+	case err := <-inserted:
+		t.Fatalf("expected the insert to wait for the worker, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-inserted; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenReadDB(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir()+"/report.db"), WithWAL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if err := comfyMe.ExecScript("CREATE TABLE reported (id INTEGER PRIMARY KEY); INSERT INTO reported VALUES (1), (2);"); err != nil {
+		t.Fatal(err)
+	}
+
+	readDB, err := OpenReadDB(comfyMe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readDB.Close()
+
+	release := make(chan struct{})
+	blockingID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	defer comfyMe.Forget(blockingID)
+	defer close(release)
+
+	// no need for the worker
+	var count int
+	if err := readDB.QueryRow("SELECT COUNT(*) FROM reported").Scan(&count); err != nil || count != 2 {
+		t.Fatalf("expected 2 rows, got %d %v", count, err)
+	}
+	if _, err := readDB.Exec("INSERT INTO reported VALUES (3)"); err == nil || !strings.Contains(err.Error(), "readonly") {
+		t.Fatalf("expected a read-only error, got %v", err)
+	}
+
+	memory, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memory.Close()
+	if _, err := OpenReadDB(memory); err == nil {
+		t.Fatal("expected an error for a private in-memory database")
+	}
+}
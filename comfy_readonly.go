@@ -0,0 +1,81 @@
+package comfylite3
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Connection string of a database file opened by WithReadOnly.
+const readOnlyFileConn = "file:%s?mode=ro"
+
+// ErrReadOnly is returned for a write statement submitted to a database opened with WithReadOnly.
+var ErrReadOnly = errors.New("database is read-only")
+
+// Statements refused by WithReadOnly, by first keyword.
+var writeKeywords = map[string]bool{
+	"INSERT":  true,
+	"UPDATE":  true,
+	"DELETE":  true,
+	"REPLACE": true,
+	"UPSERT":  true,
+	"CREATE":  true,
+	"DROP":    true,
+	"ALTER":   true,
+	"VACUUM":  true,
+	"REINDEX": true,
+}
+
+// WithReadOnly opens an existing database strictly read-only: a file with `mode=ro`, any other database with `PRAGMA query_only`.
+// Writes fail with SQLite's "attempt to write a readonly database", and the statements going through Exec, Query, QueryRow or OpenDB
+// that obviously write (INSERT, UPDATE, CREATE...) are refused with ErrReadOnly before reaching the worker.
+// The migration table is not created.
+func WithReadOnly() ComfyOption {
+	return func(c *ComfyDB) {
+		c.readOnly = true
+	}
+}
+
+// Connect hook of WithReadOnly.
+func queryOnlyHook(conn *rawConn) error {
+	_, err := conn.Exec("PRAGMA query_only=ON", nil)
+	return err
+}
+
+// First keyword of a statement, past comments and parentheses.
+func firstKeyword(query string) string {
+	for {
+		query = strings.TrimLeft(query, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(query, "--"):
+			end := strings.IndexByte(query, '\n')
+			if end < 0 {
+				return ""
+			}
+			query = query[end:]
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query, "*/")
+			if end < 0 {
+				return ""
+			}
+			query = query[end+2:]
+		default:
+			end := 0
+			for end < len(query) && isIdentifierStart(query[end]) {
+				end++
+			}
+			return strings.ToUpper(query[:end])
+		}
+	}
+}
+
+// Refuse a write statement when the database is read-only.
+func (c *ComfyDB) checkWritable(query string) error {
+	if !c.readOnly {
+		return nil
+	}
+	if keyword := firstKeyword(query); writeKeywords[keyword] {
+		return fmt.Errorf("%w: %s statement refused", ErrReadOnly, keyword)
+	}
+	return nil
+}
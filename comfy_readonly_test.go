@@ -0,0 +1,92 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFirstKeyword(t *testing.T) {
+	cases := map[string]string{
+		"SELECT 1":                           "SELECT",
+		"  -- note\n/* block */ (insert x":   "INSERT",
+		"with recent AS (SELECT 1) SELECT *": "WITH",
+		"-- only a comment":                  "",
+	}
+	for query, expected := range cases {
+		if keyword := firstKeyword(query); keyword != expected {
+			t.Errorf("expected %q for %q, got %q", expected, query, keyword)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.db")
+	writer, err := New(WithPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Exec("CREATE TABLE report (total INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Exec("INSERT INTO report VALUES (10)"); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	comfyMe, err := New(WithPath(path), WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	var total int
+	if err := comfyMe.QueryRow("SELECT total FROM report").Scan(&total); err != nil {
+		t.Fatal(err)
+	}
+	if total != 10 {
+		t.Fatalf("expected 10, got %d", total)
+	}
+
+	if _, err := comfyMe.Exec("INSERT INTO report VALUES (20)"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("UPDATE report SET total = 0"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly through OpenDB, got %v", err)
+	}
+
+	// writes sent as queries, returning rows
+	returning := "INSERT INTO report VALUES (20) RETURNING total"
+	if _, err := comfyMe.Query(returning); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly from Query, got %v", err)
+	}
+	if _, err := comfyMe.QueryContext(context.Background(), returning); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly from QueryContext, got %v", err)
+	}
+	if err := comfyMe.QueryRow("DELETE FROM report RETURNING total").Scan(&total); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly from QueryRow, got %v", err)
+	}
+	if err := comfyMe.QueryRowContext(context.Background(), returning).Scan(&total); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly from QueryRowContext, got %v", err)
+	}
+	if _, err := db.Query(returning); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly from a query through OpenDB, got %v", err)
+	}
+
+	// a write hidden from the check still fails in SQLite
+	writeID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return db.Exec("WITH v AS (SELECT 30) INSERT INTO report SELECT * FROM v")
+	})
+	if _, err := comfyMe.Result(writeID); err == nil || !strings.Contains(err.Error(), "readonly") {
+		t.Fatalf("expected SQLite's read-only error, got %v", err)
+	}
+
+	if _, err := New(WithPath(filepath.Join(t.TempDir(), "missing.db")), WithReadOnly()); err == nil {
+		t.Fatal("expected a missing file to fail in read-only mode")
+	}
+}
@@ -0,0 +1,62 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+)
+
+// Last savepoint name generated by InSavepoint.
+var savepoints atomic.Uint64
+
+// Savepoint opens a savepoint named name in tx: RollbackToSavepoint undoes what follows without ending tx.
+// It works with the transactions of OpenDB, of ComfyDB.Begin and of any sqlite3 *sql.DB.
+func Savepoint(tx *sql.Tx, name string) error {
+	return execSavepoint(tx, "SAVEPOINT %s", name)
+}
+
+// ReleaseSavepoint releases the savepoint name of tx and the ones opened after it, keeping their changes in tx.
+func ReleaseSavepoint(tx *sql.Tx, name string) error {
+	return execSavepoint(tx, "RELEASE %s", name)
+}
+
+// RollbackToSavepoint undoes the changes of tx since the savepoint name, which stays open.
+func RollbackToSavepoint(tx *sql.Tx, name string) error {
+	return execSavepoint(tx, "ROLLBACK TO %s", name)
+}
+
+// InSavepoint runs fn inside a savepoint of tx, like a nested transaction: what fn did is kept in tx when it returns nil,
+// undone when it returns an error or panics, tx staying open either way. fn's error is returned as is.
+// Calls nest, typically inside ComfyDB.Transaction, each one opening a savepoint of its own.
+func InSavepoint(tx *sql.Tx, fn func(tx *sql.Tx) error) (err error) {
+	name := fmt.Sprintf("comfy_savepoint_%d", savepoints.Add(1))
+	if err := Savepoint(tx, name); err != nil {
+		return err
+	}
+	released := false
+	defer func() {
+		if released {
+			return
+		}
+		// the savepoint stays open once rolled back to
+		if rollbackErr := RollbackToSavepoint(tx, name); rollbackErr == nil {
+			ReleaseSavepoint(tx, name)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := ReleaseSavepoint(tx, name); err != nil {
+		return err
+	}
+	released = true
+	return nil
+}
+
+func execSavepoint(tx *sql.Tx, format string, name string) error {
+	if !identifierPattern.MatchString(name) {
+		return fmt.Errorf("invalid savepoint name %q", name)
+	}
+	_, err := tx.Exec(fmt.Sprintf(format, name))
+	return err
+}
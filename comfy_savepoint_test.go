@@ -0,0 +1,147 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSavepoint(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS savepoint_pets (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM savepoint_pets"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO savepoint_pets VALUES ('kept')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Savepoint(tx, "before_undone"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO savepoint_pets VALUES ('undone')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RollbackToSavepoint(tx, "before_undone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReleaseSavepoint(tx, "before_undone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Savepoint(tx, "bad name; DROP TABLE savepoint_pets"); err == nil {
+		t.Fatal("expected an invalid savepoint name to be rejected")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// nested BeginTx on the same connection become savepoints
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	outer, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := outer.Exec("INSERT INTO savepoint_pets VALUES ('outer')"); err != nil {
+		t.Fatal(err)
+	}
+	inner, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inner.Exec("INSERT INTO savepoint_pets VALUES ('inner')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := inner.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := outer.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	rows, err := db.Query("SELECT name FROM savepoint_pets ORDER BY rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if len(names) != 2 || names[0] != "kept" || names[1] != "outer" {
+		t.Fatalf("expected kept and outer, got %v", names)
+	}
+}
+
+func TestInSavepoint(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if _, err := comfyMe.Exec("CREATE TABLE IF NOT EXISTS nested_steps (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("DELETE FROM nested_steps"); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("step failed")
+	err = comfyMe.Transaction(context.Background(), func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO nested_steps VALUES ('outer')"); err != nil {
+			return err
+		}
+		if err := InSavepoint(tx, func(tx *sql.Tx) error {
+			if _, err := tx.Exec("INSERT INTO nested_steps VALUES ('kept')"); err != nil {
+				return err
+			}
+			if err := InSavepoint(tx, func(tx *sql.Tx) error {
+				if _, err := tx.Exec("INSERT INTO nested_steps VALUES ('undone')"); err != nil {
+					return err
+				}
+				return failure
+			}); !errors.Is(err, failure) {
+				t.Errorf("expected the error of the step, got %v", err)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	if err := Select(comfyMe, &names, "SELECT name FROM nested_steps ORDER BY rowid"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "outer,kept" {
+		t.Fatalf("expected the failed step only to be undone, got %v", names)
+	}
+}
@@ -0,0 +1,227 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"strings"
+	"unicode"
+)
+
+// Outcome of one statement of a script.
+type StatementResult struct {
+	Statement    string
+	RowsAffected int64
+	Err          error
+}
+
+// Split a SQL script into its statements.
+// Quotes, comments and the bodies of CREATE TRIGGER statements are honored.
+func splitStatements(script string) []string {
+	statements := []string{}
+	var current strings.Builder
+	words := []string{} // first words of the current statement, to detect triggers
+	var word strings.Builder
+	trigger := false // current statement is a CREATE TRIGGER
+	body := false    // inside the BEGIN ... END of a trigger
+	cases := 0       // CASE ... END nested in a trigger body
+
+	flushWord := func() {
+		if word.Len() == 0 {
+			return
+		}
+		w := strings.ToUpper(word.String())
+		word.Reset()
+		if len(words) < 4 {
+			words = append(words, w)
+			if w == "TRIGGER" && len(words) >= 2 && words[0] == "CREATE" {
+				trigger = true
+			}
+		}
+		if !trigger {
+			return
+		}
+		switch w {
+		case "BEGIN":
+			body = true
+		case "CASE":
+			if body {
+				cases++
+			}
+		case "END":
+			if body {
+				if cases > 0 {
+					cases--
+				} else {
+					body = false
+				}
+			}
+		}
+	}
+
+	flushStatement := func() {
+		statement := strings.TrimSpace(current.String())
+		if statement != "" && statement != ";" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+		words = words[:0]
+		trigger, body, cases = false, false, 0
+	}
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\'' || r == '"' || r == '`' || r == '[':
+			flushWord()
+			closing := r
+			if r == '[' {
+				closing = ']'
+			}
+			current.WriteRune(r)
+			for i++; i < len(runes); i++ {
+				current.WriteRune(runes[i])
+				if runes[i] == closing {
+					// doubled quotes are escaped quotes
+					if closing != ']' && i+1 < len(runes) && runes[i+1] == closing {
+						i++
+						current.WriteRune(runes[i])
+						continue
+					}
+					break
+				}
+			}
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			flushWord()
+			for ; i < len(runes) && runes[i] != '\n'; i++ {
+				current.WriteRune(runes[i])
+			}
+			if i < len(runes) {
+				current.WriteRune(runes[i])
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			flushWord()
+			current.WriteString("/*")
+			for i += 2; i < len(runes); i++ {
+				current.WriteRune(runes[i])
+				if runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/' {
+					i++
+					current.WriteRune(runes[i])
+					break
+				}
+			}
+		case r == ';':
+			flushWord()
+			current.WriteRune(r)
+			if !body {
+				flushStatement()
+			}
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			word.WriteRune(r)
+			current.WriteRune(r)
+		default:
+			flushWord()
+			current.WriteRune(r)
+		}
+	}
+	flushWord()
+	flushStatement()
+
+	return statements
+}
+
+// Common subset of *sql.DB and *sql.Tx.
+type execQueryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Execute statements one by one, stopping at the first failure.
+func execStatements(db execQueryer, statements []string) ([]StatementResult, error) {
+	results := make([]StatementResult, 0, len(statements))
+	var before int64
+	if err := db.QueryRow("SELECT total_changes()").Scan(&before); err != nil {
+		return results, err
+	}
+	for _, statement := range statements {
+		result := StatementResult{Statement: statement}
+		if _, err := db.Exec(statement); err != nil {
+			result.Err = err
+			results = append(results, result)
+			return results, fmt.Errorf("failed to execute statement %d: %w", len(results), err)
+		}
+		var after int64
+		if err := db.QueryRow("SELECT total_changes()").Scan(&after); err != nil {
+			return results, err
+		}
+		result.RowsAffected = after - before
+		before = after
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ExecScript executes a multi-statement script, schema, seed data or triggers, as a single job in a single transaction:
+// when a statement fails, none of them is applied. The script can't hold BEGIN/COMMIT itself, see ExecScriptDetailed.
+func (c *ComfyDB) ExecScript(script string) error {
+	statements := splitStatements(script)
+	scriptID := c.New(func(db *sql.DB) (interface{}, error) {
+		tx, err := db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		if _, err := execStatements(tx, statements); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	})
+	result, err := c.await(scriptID)
+	if err != nil {
+		return err
+	}
+	if errResult, ok := result.(error); ok {
+		return fmt.Errorf("failed to execute the script: %w", errResult)
+	}
+	return nil
+}
+
+// ExecScriptFS reads the script name from fsys, an embed.FS typically, and executes it like ExecScript.
+func (c *ComfyDB) ExecScriptFS(fsys fs.FS, name string) error {
+	script, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return fmt.Errorf("failed to read the script: %w", err)
+	}
+	return c.ExecScript(string(script))
+}
+
+// ExecScriptDetailed executes a multi-statement script on the worker and reports, for each statement, how many rows it changed.
+// Execution stops at the first failing statement, which is the last one reported with its error.
+// The script is not wrapped in a transaction, use BEGIN/COMMIT in the script if you need one.
+func (c *ComfyDB) ExecScriptDetailed(script string) ([]StatementResult, error) {
+	statements := splitStatements(script)
+	scriptID := c.New(func(db *sql.DB) (interface{}, error) {
+		// the worker has a single connection so total_changes() is consistent across statements
+		results, err := execStatements(db, statements)
+		return scriptOutcome{results: results, err: err}, nil
+	})
+	result, err := c.await(scriptID)
+	if err != nil {
+		return nil, err
+	}
+	switch value := result.(type) {
+	case scriptOutcome:
+		return value.results, value.err
+	case error:
+		return nil, value
+	default:
+		return nil, fmt.Errorf("unexpected type")
+	}
+}
+
+// Partial results of a script are kept even when it fails.
+type scriptOutcome struct {
+	results []StatementResult
+	err     error
+}
@@ -0,0 +1,105 @@
+package comfylite3
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+-- a comment; with a semicolon
+CREATE TABLE scripted (id INTEGER PRIMARY KEY, name TEXT, kind TEXT);
+INSERT INTO scripted (name) VALUES ('semi;colon'), ("double;quoted");
+/* block; comment */
+CREATE TRIGGER scripted_kind AFTER INSERT ON scripted BEGIN
+	UPDATE scripted SET kind = CASE WHEN NEW.name LIKE 'a%' THEN 'a' ELSE 'other' END WHERE id = NEW.id;
+	SELECT 1;
+END;
+DELETE FROM scripted`
+
+	statements := splitStatements(script)
+	if len(statements) != 4 {
+		for _, statement := range statements {
+			t.Log(statement)
+		}
+		t.Fatalf("expected 4 statements, got %d", len(statements))
+	}
+}
+
+func TestExecScriptDetailed(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	results, err := comfyMe.ExecScriptDetailed(`
+CREATE TABLE detailed (id INTEGER PRIMARY KEY, name TEXT);
+INSERT INTO detailed (name) VALUES ('a'), ('b'), ('c');
+UPDATE detailed SET name = 'z' WHERE name != 'a';
+CREATE INDEX detailed_name ON detailed (name);
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int64{0, 3, 2, 0}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(results))
+	}
+	for i, result := range results {
+		if result.RowsAffected != expected[i] {
+			t.Fatalf("statement %d (%s): expected %d rows affected, got %d", i, result.Statement, expected[i], result.RowsAffected)
+		}
+	}
+
+	results, err = comfyMe.ExecScriptDetailed(`
+INSERT INTO detailed (name) VALUES ('d');
+INSERT INTO missing (name) VALUES ('e');
+INSERT INTO detailed (name) VALUES ('f');
+`)
+	if err == nil {
+		t.Fatal("expected the script to fail")
+	}
+	if len(results) != 2 || results[1].Err == nil {
+		t.Fatalf("expected the second statement to be reported as failed, got %+v", results)
+	}
+}
+
+func TestExecScript(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/script.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	fsys := fstest.MapFS{"schema.sql": {Data: []byte(`
+CREATE TABLE scripted (id INTEGER PRIMARY KEY, name TEXT);
+CREATE TRIGGER scripted_upper AFTER INSERT ON scripted BEGIN
+	UPDATE scripted SET name = upper(NEW.name) WHERE id = NEW.id;
+END;
+INSERT INTO scripted (name) VALUES ('a;b');
+`)}}
+	if err := comfyMe.ExecScriptFS(fsys, "schema.sql"); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if err := comfyMe.QueryRow("SELECT name FROM scripted").Scan(&name); err != nil || name != "A;B" {
+		t.Fatalf("expected A;B, got %q %v", name, err)
+	}
+
+	err = comfyMe.ExecScript(`
+INSERT INTO scripted (name) VALUES ('c');
+INSERT INTO missing (name) VALUES ('d');
+`)
+	if err == nil {
+		t.Fatal("expected the script to fail")
+	}
+	var count int
+	if err := comfyMe.QueryRow("SELECT count(*) FROM scripted").Scan(&count); err != nil || count != 1 {
+		t.Fatalf("expected the script to be rolled back, got %d rows %v", count, err)
+	}
+
+	if err := comfyMe.ExecScriptFS(fsys, "missing.sql"); err == nil {
+		t.Fatal("expected an error for a missing script")
+	}
+}
@@ -0,0 +1,205 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// Select runs query on the worker and appends every row to dest, scanned into a T.
+// A struct T, or pointer to struct, gets each column in the field tagged `db:"column"`,
+// or the field of the same name ignoring case when untagged, `db:"-"` skipping the field.
+// A column without field fails the query, use a pointer field for a nullable column. But a struct without any db tag
+// and as many fields as columns gets them in order, like `SELECT COUNT(*), MAX(id)` into struct{ Count, Max int }.
+// Any other T scans the single column of the rows, like `Select(c, &names, "SELECT name FROM users")`.
+func Select[T any](c *ComfyDB, dest *[]T, query string, args ...interface{}) error {
+	rows, err := Do(c, func(db *sql.DB) ([]T, error) {
+		c.echoQuery(query, args)
+		rows, err := c.queryCached(context.Background(), db, query, args)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		scan, err := rowScanner[T](rows)
+		if err != nil {
+			return nil, err
+		}
+		result := []T{}
+		for rows.Next() {
+			row, err := scan()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, row)
+		}
+		return result, rows.Err()
+	})
+	if err != nil {
+		return err
+	}
+	*dest = append(*dest, rows...)
+	return nil
+}
+
+// Get runs query on the worker and scans its first row into dest like Select does,
+// sql.ErrNoRows when it has none.
+func Get[T any](c *ComfyDB, dest *T, query string, args ...interface{}) error {
+	row, err := Do(c, func(db *sql.DB) (T, error) {
+		var zero T
+		c.echoQuery(query, args)
+		rows, err := c.queryCached(context.Background(), db, query, args)
+		if err != nil {
+			return zero, err
+		}
+		defer rows.Close()
+		scan, err := rowScanner[T](rows)
+		if err != nil {
+			return zero, err
+		}
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return zero, err
+			}
+			return zero, sql.ErrNoRows
+		}
+		return scan()
+	})
+	if err != nil {
+		return err
+	}
+	*dest = row
+	return nil
+}
+
+// QueryAll is Select returning the rows, like `users, err := QueryAll[User](c, "SELECT id, name FROM users")`.
+func QueryAll[T any](c *ComfyDB, query string, args ...interface{}) ([]T, error) {
+	var rows []T
+	if err := Select(c, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// QueryOne is Get returning the row, sql.ErrNoRows when there is none.
+func QueryOne[T any](c *ComfyDB, query string, args ...interface{}) (T, error) {
+	var row T
+	err := Get(c, &row, query, args...)
+	return row, err
+}
+
+// Scanner of the current row of rows into a new T, mapping the columns once.
+func rowScanner[T any](rows *sql.Rows) (func() (T, error), error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	structType := typ
+	if structType.Kind() == reflect.Pointer {
+		structType = structType.Elem()
+	}
+
+	if structType.Kind() != reflect.Struct || reflect.PointerTo(structType).Implements(scannerType) {
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("expected 1 column to scan into %v, got %d", typ, len(columns))
+		}
+		return func() (T, error) {
+			var row T
+			err := rows.Scan(&row)
+			return row, err
+		}, nil
+	}
+
+	fields := structFields(structType)
+	indexes := make([][]int, len(columns))
+	for i, column := range columns {
+		index, ok := fields[strings.ToLower(column)]
+		if !ok {
+			// an untagged struct with a field per column takes them in order
+			ordered, tagged := orderedFields(structType)
+			if tagged || len(ordered) != len(columns) {
+				return nil, fmt.Errorf("column %q has no field in %v", column, structType)
+			}
+			indexes = ordered
+			break
+		}
+		indexes[i] = index
+	}
+	dest := make([]interface{}, len(columns))
+	return func() (T, error) {
+		var row T
+		value := reflect.ValueOf(&row).Elem()
+		if typ.Kind() == reflect.Pointer {
+			value.Set(reflect.New(structType))
+			value = value.Elem()
+		}
+		for i, index := range indexes {
+			dest[i] = value.FieldByIndex(index).Addr().Interface()
+		}
+		err := rows.Scan(dest...)
+		return row, err
+	}, nil
+}
+
+// Index of the fields of a struct by lowercase column name, embedded structs included.
+func structFields(typ reflect.Type) map[string][]int {
+	fields := map[string][]int{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			// exported or not, its exported fields are promoted
+			for name, index := range structFields(field.Type) {
+				// the fields of the struct itself win
+				if _, ok := fields[name]; !ok {
+					fields[name] = append([]int{i}, index...)
+				}
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = []int{i}
+	}
+	return fields
+}
+
+// Index of the fields of a struct in declaration order, embedded structs included, and whether any has a db tag.
+func orderedFields(typ reflect.Type) ([][]int, bool) {
+	fields := [][]int{}
+	tagged := false
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("db")
+		if tag != "" {
+			tagged = true
+		}
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			embedded, embeddedTagged := orderedFields(field.Type)
+			for _, index := range embedded {
+				fields = append(fields, append([]int{i}, index...))
+			}
+			tagged = tagged || embeddedTagged
+			continue
+		}
+		if field.IsExported() {
+			fields = append(fields, []int{i})
+		}
+	}
+	return fields, tagged
+}
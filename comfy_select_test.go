@@ -0,0 +1,133 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type selectBase struct {
+	ID int64 `db:"id"`
+}
+
+type selectUser struct {
+	selectBase
+	Name     string  `db:"name"`
+	Nickname *string `db:"nickname"`
+	Age      int
+	Ignored  string `db:"-"`
+}
+
+func TestSelect(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if _, err := comfyMe.Exec("CREATE TABLE IF NOT EXISTS select_users (id INTEGER PRIMARY KEY, name TEXT, nickname TEXT, age INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("DELETE FROM select_users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO select_users (id, name, nickname, age) VALUES (1, 'John', 'Johnny', 42), (2, 'Jane', NULL, 37)"); err != nil {
+		t.Fatal(err)
+	}
+
+	users := []selectUser{}
+	if err := Select(comfyMe, &users, "SELECT id, name, nickname, age FROM select_users ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].ID != 1 || users[0].Name != "John" || users[0].Age != 42 || users[1].Name != "Jane" {
+		t.Fatalf("unexpected users %+v", users)
+	}
+	if users[0].Nickname == nil || *users[0].Nickname != "Johnny" || users[1].Nickname != nil {
+		t.Fatalf("expected the nullable nickname in a pointer, got %v %v", users[0].Nickname, users[1].Nickname)
+	}
+
+	pointers := []*selectUser{}
+	if err := Select(comfyMe, &pointers, "SELECT name FROM select_users WHERE id = ?", 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(pointers) != 1 || pointers[0].Name != "Jane" {
+		t.Fatalf("unexpected users %+v", pointers)
+	}
+
+	names := []string{"before"}
+	if err := Select(comfyMe, &names, "SELECT name FROM select_users ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "before,John,Jane" {
+		t.Fatalf("expected the names to be appended, got %v", names)
+	}
+
+	if err := Select(comfyMe, &users, "SELECT id, name AS surname FROM select_users"); err == nil || !strings.Contains(err.Error(), `"surname"`) {
+		t.Fatalf("expected an error for the column without field, got %v", err)
+	}
+	if err := Select(comfyMe, &names, "SELECT id, name FROM select_users"); err == nil {
+		t.Fatal("expected an error scanning two columns into a string")
+	}
+
+	var user selectUser
+	if err := Get(comfyMe, &user, "SELECT id, name, age FROM select_users WHERE id = ?", 1); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 1 || user.Name != "John" || user.Age != 42 {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	var count int
+	if err := Get(comfyMe, &count, "SELECT COUNT(*) FROM select_users"); err != nil || count != 2 {
+		t.Fatalf("expected 2 users, got %d %v", count, err)
+	}
+	if err := Get(comfyMe, &user, "SELECT id FROM select_users WHERE id = 3"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	// untagged, in order
+	var stats struct {
+		Count  int
+		Oldest int
+	}
+	if err := Get(comfyMe, &stats, "SELECT COUNT(*), MAX(age) FROM select_users"); err != nil || stats.Count != 2 || stats.Oldest != 42 {
+		t.Fatalf("expected the columns in field order, got %+v %v", stats, err)
+	}
+	if err := Get(comfyMe, &stats, "SELECT COUNT(*) FROM select_users"); err == nil {
+		t.Fatal("expected an error for a column count not matching the fields")
+	}
+}
+
+func TestQueryAllAndOne(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/select.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if _, err := comfyMe.Exec("CREATE TABLE select_users (id INTEGER PRIMARY KEY, name TEXT, nickname TEXT, age INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO select_users (id, name, age) VALUES (1, 'John', 42), (2, 'Jane', 37)"); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := QueryAll[selectUser](comfyMe, "SELECT id, name, age FROM select_users ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Name != "John" || users[1].Age != 37 {
+		t.Fatalf("unexpected users %+v", users)
+	}
+	if _, err := QueryAll[string](comfyMe, "SELECT missing FROM select_users"); err == nil {
+		t.Fatal("expected an error for the missing column")
+	}
+
+	name, err := QueryOne[string](comfyMe, "SELECT name FROM select_users WHERE id = ?", 2)
+	if err != nil || name != "Jane" {
+		t.Fatalf("expected Jane, got %q %v", name, err)
+	}
+	if _, err := QueryOne[selectUser](comfyMe, "SELECT id FROM select_users WHERE id = 3"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package comfylite3
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// WithSlog sends structured events to logger: jobs enqueued, started and finished at debug level, failed jobs
+// and a full queue of WithMaxQueue as warnings, along with the failures of the watchdog, the checkpoints and
+// the pragmas of OpenDB. Without it, nothing is logged.
+func WithSlog(logger *slog.Logger) ComfyOption {
+	return func(c *ComfyDB) {
+		c.slogger = logger
+	}
+}
+
+// Logger of the warnings, discarding them without WithSlog.
+func (c *ComfyDB) warnings() *slog.Logger {
+	if c.slogger != nil {
+		return c.slogger
+	}
+	return slog.New(discardHandler{})
+}
+
+// Handler of a logger that logs nothing.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// Log a job event of WithSlog, nothing without it.
+func (c *ComfyDB) logJob(level slog.Level, msg string, item *workItem, attrs ...slog.Attr) {
+	if c.slogger == nil || !c.slogger.Enabled(context.Background(), level) {
+		return
+	}
+	attrs = append([]slog.Attr{slog.Uint64("id", item.id)}, attrs...)
+	if item.query != "" {
+		attrs = append(attrs, slog.String("query", item.query))
+	}
+	c.slogger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// Log the outcome of a job run in duration.
+func (c *ComfyDB) logFinished(item *workItem, duration time.Duration, err error) {
+	if err != nil {
+		c.logJob(slog.LevelWarn, "comfylite3: job failed", item, slog.Duration("duration", duration), slog.Any("error", err))
+		return
+	}
+	c.logJob(slog.LevelDebug, "comfylite3: job finished", item, slog.Duration("duration", duration))
+}
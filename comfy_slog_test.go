@@ -0,0 +1,85 @@
+package comfylite3
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	comfyMe, err := New(WithPath(t.TempDir()+"/slog.db"), WithSlog(logger), WithMaxQueue(1), WithRejectWhenFull(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	okID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return nil, nil
+	})
+	if _, err := comfyMe.Result(okID); err != nil {
+		t.Fatal(err)
+	}
+	db := OpenDB(comfyMe)
+	if _, err := db.Exec("SELECT missing"); err == nil {
+		t.Fatal("expected the statement to fail")
+	}
+	db.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	busyID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+	comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return nil, nil
+	})
+	rejectedID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return nil, nil
+	})
+	if _, err := comfyMe.Result(rejectedID); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	close(release)
+	comfyMe.Result(busyID)
+	if err := comfyMe.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := buf.String()
+	for _, want := range []string{
+		`level=DEBUG msg="comfylite3: job enqueued"`,
+		`level=DEBUG msg="comfylite3: job started"`,
+		`level=DEBUG msg="comfylite3: job finished"`,
+		`level=WARN msg="comfylite3: job failed"`,
+		`query="SELECT missing"`,
+		`level=WARN msg="comfylite3: queue is full, job rejected"`,
+	} {
+		if !strings.Contains(logs, want) {
+			t.Fatalf("expected %s in the logs, got:\n%s", want, logs)
+		}
+	}
+}
+
+func TestSlogDefaultSilent(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	comfyMe, err := New(WithPath(t.TempDir() + "/silent.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	comfyMe.warnings().Warn("comfylite3: checkpoint failed")
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing logged without WithSlog, got:\n%s", buf.String())
+	}
+}
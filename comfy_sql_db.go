@@ -4,30 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"fmt"
 	"time"
 )
 
 /// It's time to replace my own version of sql.DB to be plug and play with other libraries
 
 // implement Ping() error of sql.DB with Comfy
+// It waits as long as it takes, use PingContext with a deadline for health checks.
 func (c *ComfyDB) Ping() error {
-	pingID := c.New(func(db *sql.DB) (interface{}, error) {
-		return nil, db.Ping()
-	})
-	result := <-c.WaitForChn(pingID)
-	switch data := result.(type) {
-	case error:
-		return data
-	default:
-		return nil
-	}
+	return c.PingContext(context.Background())
 }
 
 func (c *ComfyDB) Begin() (*sql.Tx, error) {
 	txID := c.New(func(db *sql.DB) (interface{}, error) {
 		return db.Begin()
 	})
-	result := <-c.WaitForChn(txID)
+	result := c.awaitOutcome(txID)
 	switch data := result.(type) {
 	case *sql.Tx:
 		return data, nil
@@ -40,7 +34,7 @@ func (c *ComfyDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, er
 	txID := c.New(func(db *sql.DB) (interface{}, error) {
 		return db.BeginTx(ctx, opts)
 	})
-	result := <-c.WaitForChn(txID)
+	result := c.awaitOutcome(txID)
 	switch data := result.(type) {
 	case *sql.Tx:
 		return data, nil
@@ -53,7 +47,7 @@ func (c *ComfyDB) Conn(ctx context.Context) (*sql.Conn, error) {
 	connID := c.New(func(db *sql.DB) (interface{}, error) {
 		return db.Conn(ctx)
 	})
-	result := <-c.WaitForChn(connID)
+	result := c.awaitOutcome(connID)
 	switch data := result.(type) {
 	case *sql.Conn:
 		return data, nil
@@ -66,7 +60,7 @@ func (c *ComfyDB) Driver() driver.Driver {
 	driverID := c.New(func(db *sql.DB) (interface{}, error) {
 		return db.Driver(), nil
 	})
-	result := <-c.WaitForChn(driverID)
+	result := c.awaitOutcome(driverID)
 	switch data := result.(type) {
 	case driver.Driver:
 		return data
@@ -76,10 +70,14 @@ func (c *ComfyDB) Driver() driver.Driver {
 }
 
 func (c *ComfyDB) Exec(query string, args ...interface{}) (sql.Result, error) {
-	execID := c.New(func(db *sql.DB) (interface{}, error) {
-		return db.Exec(query, args...)
+	if err := c.checkWritable(query); err != nil {
+		return nil, err
+	}
+	execID := c.submitExec(context.Background(), query, func(_ context.Context, db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, args)
+		return c.execCached(context.Background(), db, query, args)
 	})
-	result := <-c.WaitForChn(execID)
+	result := c.awaitOutcome(execID)
 	switch data := result.(type) {
 	case sql.Result:
 		return data, nil
@@ -88,11 +86,16 @@ func (c *ComfyDB) Exec(query string, args ...interface{}) (sql.Result, error) {
 	}
 }
 
+// ExecContext executes a query on the worker, dropped if ctx is done before it runs and interrupted if it's done meanwhile.
 func (c *ComfyDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	execID := c.New(func(db *sql.DB) (interface{}, error) {
-		return db.ExecContext(ctx, query, args...)
+	if err := c.checkWritable(query); err != nil {
+		return nil, err
+	}
+	execID := c.submitExec(ctx, query, func(jobCtx context.Context, db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, args)
+		return c.execCached(jobCtx, db, query, args)
 	})
-	result := <-c.WaitForChn(execID)
+	result := c.awaitOutcome(execID)
 	switch data := result.(type) {
 	case sql.Result:
 		return data, nil
@@ -101,13 +104,19 @@ func (c *ComfyDB) ExecContext(ctx context.Context, query string, args ...interfa
 	}
 }
 
+// PingContext probes the worker and the database: a `SELECT 1` job goes through the queue and must answer before ctx is done.
+// A worker stuck on a job, or a queue not draining fast enough, makes it fail with the number of pending jobs.
 func (c *ComfyDB) PingContext(ctx context.Context) error {
-	pingID := c.New(func(db *sql.DB) (interface{}, error) {
-		return nil, db.PingContext(ctx)
+	pingID := c.newContext(ctx, func(jobCtx context.Context, db *sql.DB) (interface{}, error) {
+		var one int
+		return nil, db.QueryRowContext(jobCtx, "SELECT 1").Scan(&one)
 	})
-	result := <-c.WaitForChn(pingID)
+	result := c.awaitOutcome(pingID)
 	switch data := result.(type) {
 	case error:
+		if ctx.Err() != nil && errors.Is(data, ctx.Err()) {
+			return fmt.Errorf("worker didn't answer the ping, %d jobs pending: %w", c.Metrics().Pending, data)
+		}
 		return data
 	default:
 		return nil
@@ -116,9 +125,10 @@ func (c *ComfyDB) PingContext(ctx context.Context) error {
 
 func (c *ComfyDB) Prepare(query string) (*sql.Stmt, error) {
 	stmtID := c.New(func(db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, nil)
 		return db.Prepare(query)
 	})
-	result := <-c.WaitForChn(stmtID)
+	result := c.awaitOutcome(stmtID)
 	switch data := result.(type) {
 	case *sql.Stmt:
 		return data, nil
@@ -127,11 +137,13 @@ func (c *ComfyDB) Prepare(query string) (*sql.Stmt, error) {
 	}
 }
 
+// PrepareContext prepares a statement on the worker, dropped if ctx is done before it runs.
 func (c *ComfyDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
-	stmtID := c.New(func(db *sql.DB) (interface{}, error) {
-		return db.PrepareContext(ctx, query)
+	stmtID := c.newContext(ctx, func(jobCtx context.Context, db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, nil)
+		return db.PrepareContext(jobCtx, query)
 	})
-	result := <-c.WaitForChn(stmtID)
+	result := c.awaitOutcome(stmtID)
 	switch data := result.(type) {
 	case *sql.Stmt:
 		return data, nil
@@ -141,10 +153,14 @@ func (c *ComfyDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt,
 }
 
 func (c *ComfyDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	rowsID := c.New(func(db *sql.DB) (interface{}, error) {
-		return db.Query(query, args...)
+	if err := c.checkWritable(query); err != nil {
+		return nil, err
+	}
+	rowsID := c.submitQuery(context.Background(), query, func(_ context.Context, db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, args)
+		return c.queryCached(context.Background(), db, query, args)
 	})
-	result := <-c.WaitForChn(rowsID)
+	result := c.awaitOutcome(rowsID)
 	switch data := result.(type) {
 	case *sql.Rows:
 		return data, nil
@@ -153,11 +169,17 @@ func (c *ComfyDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
 	}
 }
 
+// QueryContext queries on the worker, dropped if ctx is done before it runs.
 func (c *ComfyDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	rowsID := c.New(func(db *sql.DB) (interface{}, error) {
-		return db.QueryContext(ctx, query, args...)
+	if err := c.checkWritable(query); err != nil {
+		return nil, err
+	}
+	rowsID := c.submitQuery(ctx, query, func(_ context.Context, db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, args)
+		// the rows outlive the job, they must not be bound to its context
+		return c.queryCached(ctx, db, query, args)
 	})
-	result := <-c.WaitForChn(rowsID)
+	result := c.awaitOutcome(rowsID)
 	switch data := result.(type) {
 	case *sql.Rows:
 		return data, nil
@@ -167,64 +189,101 @@ func (c *ComfyDB) QueryContext(ctx context.Context, query string, args ...interf
 }
 
 func (c *ComfyDB) QueryRow(query string, args ...interface{}) *sql.Row {
-	rowID := c.New(func(db *sql.DB) (interface{}, error) {
-		return db.QueryRow(query, args...), nil
-	})
-	result := <-c.WaitForChn(rowID)
-	switch data := result.(type) {
-	case *sql.Row:
-		return data
-	default:
-		return nil
+	if err := c.checkWritable(query); err != nil {
+		return errorRow(err)
 	}
+	rowID := c.submitQuery(context.Background(), query, func(_ context.Context, db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, args)
+		return c.queryRowCached(context.Background(), db, query, args), nil
+	})
+	return rowOutcome(c.awaitOutcome(rowID))
 }
 
+// QueryRowContext queries a row on the worker, dropped if ctx is done before it runs: Scan returns the error then.
 func (c *ComfyDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	rowID := c.New(func(db *sql.DB) (interface{}, error) {
-		return db.QueryRowContext(ctx, query, args...), nil
+	if err := c.checkWritable(query); err != nil {
+		return errorRow(err)
+	}
+	rowID := c.submitQuery(ctx, query, func(_ context.Context, db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, args)
+		return c.queryRowCached(ctx, db, query, args), nil
 	})
-	result := <-c.WaitForChn(rowID)
+	return rowOutcome(c.awaitOutcome(rowID))
+}
+
+// The row of a QueryRow job, or one whose Scan returns why the job failed: closed database, full queue...
+func rowOutcome(result interface{}) *sql.Row {
 	switch data := result.(type) {
 	case *sql.Row:
 		return data
+	case error:
+		return errorRow(data)
 	default:
-		return nil
+		return errorRow(fmt.Errorf("unexpected result %T", result))
 	}
 }
 
+// A *sql.Row delivering err on Scan: database/sql doesn't build one otherwise than from a failed query.
+func errorRow(err error) *sql.Row {
+	db := sql.OpenDB(errorConnector{err: err})
+	defer db.Close()
+	return db.QueryRow("")
+}
+
+// Connector failing every connection with err, for errorRow.
+type errorConnector struct {
+	err error
+}
+
+func (ec errorConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, ec.err
+}
+
+func (ec errorConnector) Driver() driver.Driver {
+	return ec
+}
+
+func (ec errorConnector) Open(string) (driver.Conn, error) {
+	return nil, ec.err
+}
+
 func (c *ComfyDB) SetConnMaxIdleTime(d time.Duration) {
-	c.New(func(db *sql.DB) (interface{}, error) {
+	settingID := c.New(func(db *sql.DB) (interface{}, error) {
 		db.SetConnMaxIdleTime(d)
 		return nil, nil
 	})
+	c.awaitOutcome(settingID)
 }
 
 func (c *ComfyDB) SetConnMaxLifetime(d time.Duration) {
-	c.New(func(db *sql.DB) (interface{}, error) {
+	settingID := c.New(func(db *sql.DB) (interface{}, error) {
 		db.SetConnMaxLifetime(d)
 		return nil, nil
 	})
+	c.awaitOutcome(settingID)
 }
 
 func (c *ComfyDB) SetMaxIdleConns(n int) {
-	c.New(func(db *sql.DB) (interface{}, error) {
+	settingID := c.New(func(db *sql.DB) (interface{}, error) {
 		db.SetMaxIdleConns(n)
 		return nil, nil
 	})
+	c.awaitOutcome(settingID)
 }
 
 func (c *ComfyDB) SetMaxOpenConns(n int) {
-	c.New(func(db *sql.DB) (interface{}, error) {
+	settingID := c.New(func(db *sql.DB) (interface{}, error) {
 		db.SetMaxOpenConns(n)
 		return nil, nil
 	})
+	c.awaitOutcome(settingID)
 }
 
 func (c *ComfyDB) Stats() sql.DBStats {
 	statsID := c.New(func(db *sql.DB) (interface{}, error) {
 		return db.Stats(), nil
 	})
-	result := <-c.WaitForChn(statsID)
+	result := c.awaitOutcome(statsID)
 	switch data := result.(type) {
 	case sql.DBStats:
 		return data
@@ -0,0 +1,225 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Function applied to every new sqlite3 connection opened for the worker.
+type connectHook func(conn *rawConn) error
+
+// Open the database with another driver than mattn/go-sqlite3, which has no connect hooks.
+func (c *ComfyDB) openDriver(dsn string) (*sql.DB, error) {
+	if len(c.connectHooks) > 0 {
+		return nil, fmt.Errorf("connection hooks are only supported with the sqlite3 driver, got %q", c.driver)
+	}
+	return sql.Open(c.driver, dsn)
+}
+
+// Add pragmas, written name=value, to a connection string in the syntax of the driver: `_name=value` for
+// mattn/go-sqlite3, `_pragma=name(value)` otherwise, as modernc.org/sqlite and ncruces/go-sqlite3 read them.
+func (c *ComfyDB) withPragmas(dsn string, pragmas ...string) string {
+	params := make([]string, len(pragmas))
+	for i, pragma := range pragmas {
+		name, value, _ := strings.Cut(pragma, "=")
+		if c.mattn() {
+			params[i] = "_" + name + "=" + value
+		} else {
+			params[i] = "_pragma=" + name + "(" + value + ")"
+		}
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + strings.Join(params, "&")
+}
+
+// WithCommitHook registers SQLite's commit hook on the worker connection.
+// Returning a non-zero value from the hook turns the COMMIT into a ROLLBACK.
+//
+// The hook runs inside SQLite, on the worker, while the commit is in progress:
+// it must not use the database nor submit a job and wait for it (it would wait for itself).
+// Keep it fast and compute what it needs from state you maintain elsewhere.
+func WithCommitHook(hook func() int) ComfyOption {
+	return func(c *ComfyDB) {
+		c.commitHook = hook
+	}
+}
+
+// WithRollbackHook registers SQLite's rollback hook on the worker connection.
+// It is also called when a commit hook vetoes a commit.
+//
+// The same re-entrancy constraints as WithCommitHook apply.
+func WithRollbackHook(hook func()) ComfyOption {
+	return func(c *ComfyDB) {
+		c.rollbackHook = hook
+	}
+}
+
+// Is the error SQLITE_BUSY or SQLITE_LOCKED.
+func isBusy(err error) bool {
+	primary, _, ok := ResultCode(err)
+	return ok && (primary == codeBusy || primary == codeLocked)
+}
+
+// WithWAL switches the database to write-ahead logging when the worker connection opens,
+// along with `synchronous=NORMAL` (unless WithSynchronous says otherwise), which is durable enough in WAL mode.
+// New fails if SQLite couldn't switch to WAL, as it silently does for in-memory databases.
+func WithWAL() ComfyOption {
+	return WithJournalMode("WAL")
+}
+
+// WithJournalMode sets `PRAGMA journal_mode` when the worker connection opens: "DELETE", "TRUNCATE", "PERSIST",
+// "MEMORY", "WAL" or "OFF". New fails if SQLite ended up in another mode, see WithWAL.
+func WithJournalMode(mode string) ComfyOption {
+	return func(c *ComfyDB) {
+		c.journalMode = strings.ToUpper(mode)
+	}
+}
+
+// WithSynchronous sets `PRAGMA synchronous` on every connection: "OFF", "NORMAL", "FULL" or "EXTRA".
+func WithSynchronous(mode string) ComfyOption {
+	return func(c *ComfyDB) {
+		c.synchronous = strings.ToUpper(mode)
+	}
+}
+
+// WithBusyTimeout sets `PRAGMA busy_timeout` on every connection as it opens, before any job runs:
+// how long SQLite waits for a lock held by another connection before failing with SQLITE_BUSY (5 seconds by default).
+// The worker never contends with itself, the locks come from other processes using the same file,
+// from your own connections to it, or from attached databases: it matters mostly in multi-process deployments.
+// Zero fails right away. See WithBusyRetry to retry the jobs that fail anyway.
+func WithBusyTimeout(d time.Duration) ComfyOption {
+	return func(c *ComfyDB) {
+		c.busyTimeout = &d
+	}
+}
+
+// WithCacheSize sets `PRAGMA cache_size` on every connection as it opens, the readers' included:
+// a number of pages when positive, of KiB when negative. See CacheSize.
+func WithCacheSize(n int) ComfyOption {
+	return func(c *ComfyDB) {
+		c.cacheSize = &n
+	}
+}
+
+// WithTempStore sets `PRAGMA temp_store` on every connection as it opens: "DEFAULT", "FILE" or "MEMORY",
+// where the temporary tables and indices live.
+func WithTempStore(mode string) ComfyOption {
+	return func(c *ComfyDB) {
+		c.tempStore = strings.ToUpper(mode)
+	}
+}
+
+// WithMmapSize sets `PRAGMA mmap_size` on every connection as it opens: how many bytes of the file SQLite
+// memory-maps, zero disables it. SQLite caps it to the limit of the build.
+func WithMmapSize(n int64) ComfyOption {
+	return func(c *ComfyDB) {
+		c.mmapSize = &n
+	}
+}
+
+// Values of WithTempStore.
+var tempStores = map[string]bool{"DEFAULT": true, "FILE": true, "MEMORY": true}
+
+// Connect hook applying WithCacheSize, WithTempStore and WithMmapSize.
+func (c *ComfyDB) pragmaHook() (connectHook, error) {
+	statements := []string{}
+	if c.cacheSize != nil {
+		statements = append(statements, fmt.Sprintf("PRAGMA cache_size=%d", *c.cacheSize))
+	}
+	if c.tempStore != "" {
+		if !tempStores[c.tempStore] {
+			return nil, fmt.Errorf("invalid temp_store mode %q", c.tempStore)
+		}
+		statements = append(statements, "PRAGMA temp_store="+c.tempStore)
+	}
+	if c.mmapSize != nil {
+		if *c.mmapSize < 0 {
+			return nil, fmt.Errorf("invalid mmap size %d", *c.mmapSize)
+		}
+		statements = append(statements, fmt.Sprintf("PRAGMA mmap_size=%d", *c.mmapSize))
+	}
+	return func(conn *rawConn) error {
+		for _, statement := range statements {
+			if _, err := conn.Exec(statement, nil); err != nil {
+				return fmt.Errorf("failed to apply %q: %w", statement, err)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// Connect hook applying WithBusyTimeout.
+func (c *ComfyDB) busyTimeoutHook(conn *rawConn) error {
+	_, err := conn.Exec(fmt.Sprintf("PRAGMA busy_timeout=%d", c.busyTimeout.Milliseconds()), nil)
+	return err
+}
+
+// Journal modes of WithJournalMode.
+var journalModes = map[string]bool{"DELETE": true, "TRUNCATE": true, "PERSIST": true, "MEMORY": true, "WAL": true, "OFF": true}
+
+// Connect hook applying WithJournalMode and WithSynchronous, verifying SQLite accepted them.
+func (c *ComfyDB) journalHook() (connectHook, error) {
+	if c.journalMode != "" && !journalModes[c.journalMode] {
+		return nil, fmt.Errorf("invalid journal mode %q", c.journalMode)
+	}
+	synchronous := c.synchronous
+	if synchronous == "" && c.journalMode == "WAL" {
+		synchronous = "NORMAL"
+	}
+	level := map[string]string{"OFF": "0", "NORMAL": "1", "FULL": "2", "EXTRA": "3"}[synchronous]
+	if synchronous != "" && level == "" {
+		return nil, fmt.Errorf("invalid synchronous mode %q", c.synchronous)
+	}
+	return func(conn *rawConn) error {
+		if c.journalMode != "" {
+			mode, err := connPragma(conn, "PRAGMA journal_mode="+c.journalMode)
+			if err != nil {
+				return err
+			}
+			if !strings.EqualFold(mode, c.journalMode) {
+				return fmt.Errorf("failed to set journal mode %s, journal mode is %q", c.journalMode, mode)
+			}
+		}
+		if synchronous != "" {
+			if _, err := conn.Exec("PRAGMA synchronous="+synchronous, nil); err != nil {
+				return err
+			}
+			applied, err := connPragma(conn, "PRAGMA synchronous")
+			if err != nil {
+				return err
+			}
+			if applied != level {
+				return fmt.Errorf("failed to set synchronous to %s, got %s", synchronous, applied)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// Run a pragma on a raw connection and return the first column of its first row.
+func connPragma(conn *rawConn, statement string) (string, error) {
+	rows, err := conn.Query(statement, nil)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, len(rows.Columns()))
+	if err := rows.Next(dest); err != nil {
+		return "", fmt.Errorf("failed to read %q: %w", statement, err)
+	}
+	if len(dest) == 0 {
+		return "", nil
+	}
+	switch value := dest[0].(type) {
+	case []byte:
+		return string(value), nil
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
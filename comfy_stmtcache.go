@@ -0,0 +1,202 @@
+package comfylite3
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// WithStmtCache keeps up to size prepared statements of the worker connection, keyed by their SQL text,
+// the least recently used one being closed to make room for a new one.
+// The queries of Exec, Query, QueryRow and OpenDB reuse them rather than preparing again. Inside a transaction of OpenDB,
+// the statements not cached yet are prepared for the transaction only, and closed with it.
+// Scripts of several statements are never cached, the jobs of New get the sql.DB as is.
+func WithStmtCache(size int) ComfyOption {
+	return func(c *ComfyDB) {
+		if size > 0 {
+			c.stmts = newStmtCache(size)
+		}
+	}
+}
+
+// Cached statement, nil when the query holds several statements and runs without one.
+type cachedStmt struct {
+	query string
+	stmt  *sql.Stmt
+}
+
+// LRU of the prepared statements of WithStmtCache.
+type stmtCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // most recently used first
+	items map[string]*list.Element
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// The statement of query, prepared on db when it's not cached yet. Nil when the query can't be cached.
+func (s *stmtCache) get(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.items[query]; ok {
+		s.order.MoveToFront(element)
+		return element.Value.(*cachedStmt).stmt, nil
+	}
+
+	cached := &cachedStmt{query: query}
+	// a prepared statement only runs the first statement of a script
+	if len(splitStatements(query)) == 1 {
+		stmt, err := db.PrepareContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		cached.stmt = stmt
+	}
+	s.items[query] = s.order.PushFront(cached)
+	if s.order.Len() > s.size {
+		s.evict(s.order.Back())
+	}
+	return cached.stmt, nil
+}
+
+// The statement of query when it's cached already, without preparing it.
+func (s *stmtCache) lookup(query string) (*sql.Stmt, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.items[query]
+	if !ok {
+		return nil, false
+	}
+	s.order.MoveToFront(element)
+	return element.Value.(*cachedStmt).stmt, true
+}
+
+func (s *stmtCache) evict(element *list.Element) {
+	cached := s.order.Remove(element).(*cachedStmt)
+	delete(s.items, cached.query)
+	if cached.stmt != nil {
+		// rows still open keep the statement until they're closed
+		cached.stmt.Close()
+	}
+}
+
+// Close every statement, before the connection closes.
+func (s *stmtCache) clear() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.order.Len() > 0 {
+		s.evict(s.order.Back())
+	}
+}
+
+// The cached statement of query when WithStmtCache applies to db.
+func (c *ComfyDB) cachedStmt(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, error) {
+	if c.stmts == nil || db != c.db {
+		return nil, nil
+	}
+	return c.stmts.get(ctx, db, query)
+}
+
+// ExecContext on the worker, through the statement cache.
+func (c *ComfyDB) execCached(ctx context.Context, db *sql.DB, query string, args []interface{}) (sql.Result, error) {
+	args = trimNamedPrefixes(args)
+	stmt, err := c.cachedStmt(ctx, db, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return db.ExecContext(ctx, query, args...)
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+// QueryContext on the worker, through the statement cache.
+func (c *ComfyDB) queryCached(ctx context.Context, db *sql.DB, query string, args []interface{}) (*sql.Rows, error) {
+	args = trimNamedPrefixes(args)
+	stmt, err := c.cachedStmt(ctx, db, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return db.QueryContext(ctx, query, args...)
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+// QueryRowContext on the worker, through the statement cache.
+func (c *ComfyDB) queryRowCached(ctx context.Context, db *sql.DB, query string, args []interface{}) *sql.Row {
+	args = trimNamedPrefixes(args)
+	stmt, err := c.cachedStmt(ctx, db, query)
+	if err != nil || stmt == nil {
+		// a failed prepare fails the same way, the error surfaces on Scan
+		return db.QueryRowContext(ctx, query, args...)
+	}
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+// The statement of query in a transaction of OpenDB, nil without WithStmtCache or for a script.
+// Preparing on the sql.DB would wait for the connection the transaction holds: the cached statement is used
+// when there is one, else the statement is prepared on the transaction and kept until it ends.
+func (ct *comfyTx) cachedStmt(ctx context.Context, tx *sql.Tx, query string) (*sql.Stmt, error) {
+	if ct.comfy.stmts == nil {
+		return nil, nil
+	}
+	if stmt, ok := ct.comfy.stmts.lookup(query); ok {
+		if stmt == nil {
+			return nil, nil
+		}
+		return tx.StmtContext(ctx, stmt), nil
+	}
+	if stmt, ok := ct.stmts[query]; ok {
+		return stmt, nil
+	}
+	var stmt *sql.Stmt
+	if len(splitStatements(query)) == 1 {
+		var err error
+		if stmt, err = tx.PrepareContext(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+	if ct.stmts == nil {
+		ct.stmts = make(map[string]*sql.Stmt)
+	}
+	ct.stmts[query] = stmt
+	return stmt, nil
+}
+
+// ExecContext in a transaction of OpenDB, through the statement cache.
+func (ct *comfyTx) execCached(ctx context.Context, tx *sql.Tx, query string, args []interface{}) (sql.Result, error) {
+	args = trimNamedPrefixes(args)
+	stmt, err := ct.cachedStmt(ctx, tx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return tx.ExecContext(ctx, query, args...)
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+// QueryContext in a transaction of OpenDB, through the statement cache.
+func (ct *comfyTx) queryCached(ctx context.Context, tx *sql.Tx, query string, args []interface{}) (*sql.Rows, error) {
+	args = trimNamedPrefixes(args)
+	stmt, err := ct.cachedStmt(ctx, tx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return tx.QueryContext(ctx, query, args...)
+	}
+	return stmt.QueryContext(ctx, args...)
+}
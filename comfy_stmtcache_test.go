@@ -0,0 +1,154 @@
+package comfylite3
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStmtCache(t *testing.T) {
+	comfyMe, err := New(WithPath(filepath.Join(t.TempDir(), "stmts.db")), WithStmtCache(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	// a script isn't cut down to its first statement
+	if _, err := comfyMe.Exec("CREATE TABLE first (n INTEGER); CREATE TABLE second (n INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := comfyMe.Exec("INSERT INTO second (n) VALUES (?)", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var count int
+	if err := comfyMe.QueryRow("SELECT COUNT(*) FROM second").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 10 {
+		t.Fatalf("expected 10 rows, got %d", count)
+	}
+
+	comfyMe.stmts.mu.Lock()
+	size := comfyMe.stmts.order.Len()
+	_, insertCached := comfyMe.stmts.items["INSERT INTO second (n) VALUES (?)"]
+	_, scriptCached := comfyMe.stmts.items["CREATE TABLE first (n INTEGER); CREATE TABLE second (n INTEGER)"]
+	comfyMe.stmts.mu.Unlock()
+	if size != 2 || !insertCached || scriptCached {
+		t.Fatalf("expected the two most recent queries to be cached, got %d", size)
+	}
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	rows, err := db.Query("SELECT n FROM second ORDER BY n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for rows.Next() {
+		var n int
+		if err := rows.Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		total += n
+	}
+	rows.Close()
+	if total != 45 {
+		t.Fatalf("expected a sum of 45, got %d", total)
+	}
+
+	if err := comfyMe.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if comfyMe.stmts.order.Len() != 0 {
+		t.Fatal("expected Close to close the cached statements")
+	}
+}
+
+func TestStmtCacheTransaction(t *testing.T) {
+	comfyMe, err := New(WithPath(filepath.Join(t.TempDir(), "stmts.db")), WithStmtCache(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if _, err := comfyMe.Exec("CREATE TABLE pets (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	// cached before the transaction
+	countQuery := "SELECT COUNT(*) FROM pets"
+	var count int
+	if err := comfyMe.QueryRow(countQuery).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	for _, commit := range []bool{false, true} {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		insert, err := tx.Prepare("INSERT INTO pets (name) VALUES (?)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			if _, err := insert.Exec("rex"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := tx.Exec("UPDATE pets SET name = 'felix'; UPDATE pets SET name = upper(name)"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.QueryRow(countQuery).Scan(&count); err != nil || count != 10 {
+			t.Fatalf("expected 10 rows in the transaction, got %d %v", count, err)
+		}
+		if commit {
+			err = tx.Commit()
+		} else {
+			err = tx.Rollback()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var upper int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pets WHERE name = 'FELIX'").Scan(&upper); err != nil || upper != 10 {
+		t.Fatalf("expected the 10 committed rows, got %d %v", upper, err)
+	}
+	comfyMe.stmts.mu.Lock()
+	_, insertCached := comfyMe.stmts.items["INSERT INTO pets (name) VALUES (?)"]
+	comfyMe.stmts.mu.Unlock()
+	if insertCached {
+		t.Fatal("expected the statements of the transaction to stay out of the cache")
+	}
+}
+
+// The insert loop of the look-and-feel test, through Exec.
+func BenchmarkStmtCache(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		opts []ComfyOption
+	}{
+		{"uncached", nil},
+		{"cached", []ComfyOption{WithStmtCache(16)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			comfyMe, err := New(append([]ComfyOption{WithPath(filepath.Join(b.TempDir(), "bench.db"))}, bench.opts...)...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer comfyMe.Close()
+			if _, err := comfyMe.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := comfyMe.Exec("INSERT INTO users (name) VALUES (?)", "user1"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
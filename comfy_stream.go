@@ -0,0 +1,167 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+)
+
+// RowIter streams the rows of a query one at a time, each Next fetching a row on the worker.
+// The cursor lives on the worker connection and is only touched by the worker, other jobs keep running between two rows.
+// Always Close it: an open cursor keeps a statement alive on the connection.
+type RowIter struct {
+	comfy   *ComfyDB
+	conn    *rawConn // worker connection owning the cursor
+	rows    driver.Rows
+	columns []string
+	values  []interface{}
+	err     error
+	closed  bool
+}
+
+// Outcome of fetching a row.
+type streamRow struct {
+	values []interface{}
+	err    error
+}
+
+// Stream runs a query on the worker and returns an iterator over its rows.
+// Rows are fetched lazily by jobs of their own, nothing is buffered on the worker.
+// The arguments are converted like database/sql does, sql.Named included.
+func (c *ComfyDB) Stream(query string, args ...interface{}) (*RowIter, error) {
+	if !c.mattn() {
+		return nil, fmt.Errorf("%w: streaming requires the sqlite3 driver", ErrUnsupported)
+	}
+	namedArgs, err := driverArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	it := &RowIter{comfy: c}
+	streamID := c.New(func(db *sql.DB) (interface{}, error) {
+		c.echoQuery(query, args)
+		return nil, withRawConn(db, func(conn *rawConn) error {
+			// the rows outlive the job, they must not be bound to its context
+			rows, err := conn.QueryContext(context.Background(), query, namedArgs)
+			if err != nil {
+				return err
+			}
+			it.conn = conn
+			it.rows = rows
+			it.columns = rows.Columns()
+			return nil
+		})
+	})
+	result, err := c.await(streamID)
+	if err != nil {
+		return nil, err
+	}
+	if errResult, ok := result.(error); ok {
+		return nil, errResult
+	}
+	return it, nil
+}
+
+// Convert the arguments of Stream to driver values.
+func driverArgs(args []interface{}) ([]driver.NamedValue, error) {
+	namedArgs := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		namedArgs[i].Ordinal = i + 1
+		if named, ok := arg.(sql.NamedArg); ok {
+			namedArgs[i].Name = named.Name
+			arg = named.Value
+		}
+		value, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert argument %d: %w", i+1, err)
+		}
+		namedArgs[i].Value = value
+	}
+	return namedArgs, nil
+}
+
+// Columns returns the names of the columns of the query.
+func (it *RowIter) Columns() []string {
+	return it.columns
+}
+
+// Next fetches the next row on the worker, false once the rows are exhausted or on error (see Err).
+// The iterator closes itself after the last row.
+func (it *RowIter) Next() bool {
+	if it.closed {
+		return false
+	}
+	nextID := it.comfy.New(func(db *sql.DB) (interface{}, error) {
+		row := streamRow{}
+		row.err = withRawConn(db, func(conn *rawConn) error {
+			if conn != it.conn {
+				return fmt.Errorf("worker connection changed while streaming")
+			}
+			dest := make([]driver.Value, len(it.columns))
+			if err := it.rows.Next(dest); err != nil {
+				return err
+			}
+			row.values = make([]interface{}, len(dest))
+			for i, value := range dest {
+				if b, ok := value.([]byte); ok {
+					value = append([]byte(nil), b...)
+				}
+				row.values[i] = value
+			}
+			return nil
+		})
+		return row, nil
+	})
+	result, err := it.comfy.await(nextID)
+	if err == nil {
+		switch value := result.(type) {
+		case streamRow:
+			err = value.err
+			it.values = value.values
+		case error:
+			err = value
+		default:
+			err = fmt.Errorf("unexpected type")
+		}
+	}
+	if err != nil {
+		if err != io.EOF {
+			it.err = err
+		}
+		it.values = nil
+		it.Close()
+		return false
+	}
+	return true
+}
+
+// Values returns the current row as driver values: int64, float64, bool, []byte, string, time.Time or nil.
+func (it *RowIter) Values() []interface{} {
+	return it.values
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *RowIter) Err() error {
+	return it.err
+}
+
+// Close releases the cursor on the worker, it's safe to call several times.
+func (it *RowIter) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	closeID := it.comfy.New(func(db *sql.DB) (interface{}, error) {
+		return nil, it.rows.Close()
+	})
+	result, err := it.comfy.await(closeID)
+	if err != nil {
+		return err
+	}
+	if errResult, ok := result.(error); ok {
+		return errResult
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	setupID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		if _, err := db.Exec("CREATE TABLE IF NOT EXISTS stream_items (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec("DELETE FROM stream_items"); err != nil {
+			return nil, err
+		}
+		return db.Exec("WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 100) INSERT INTO stream_items SELECT n, 'item' || n FROM seq")
+	})
+	if _, err := comfyMe.Result(setupID); err != nil {
+		t.Fatal(err)
+	}
+
+	it, err := comfyMe.Stream("SELECT id, name FROM stream_items WHERE id > ? ORDER BY id", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns := it.Columns(); len(columns) != 2 || columns[1] != "name" {
+		t.Fatalf("expected the id and name columns, got %v", columns)
+	}
+	rows := 0
+	for it.Next() {
+		values := it.Values()
+		if values[0] != int64(51+rows) || values[1] != fmt.Sprintf("item%d", 51+rows) {
+			t.Fatalf("unexpected row %v", values)
+		}
+		rows++
+		// other jobs run between two rows
+		if _, err := comfyMe.RunSQL(func(db *sql.DB) (interface{}, error) {
+			return db.Exec("SELECT 1")
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 50 {
+		t.Fatalf("expected 50 rows, got %d", rows)
+	}
+
+	early, err := comfyMe.Stream("SELECT id FROM stream_items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !early.Next() {
+		t.Fatal("expected a first row")
+	}
+	if err := early.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if early.Next() {
+		t.Fatal("expected no row after Close")
+	}
+
+	if _, err := comfyMe.Stream("SELECT nope FROM stream_items"); err == nil {
+		t.Fatal("expected an error for an invalid query")
+	}
+}
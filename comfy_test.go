@@ -1,14 +1,22 @@
 package comfylite3
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"errors"
+	"expvar"
 	"fmt"
 	"log/slog"
 	"math/rand"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 func TestMemory(t *testing.T) {
@@ -415,3 +423,1293 @@ func TestLockedGist(t *testing.T) {
 	// }
 
 }
+
+func TestEcho(t *testing.T) {
+	var buf bytes.Buffer
+	comfyMe, err := New(
+		WithMemory(),
+		func(c *ComfyDB) { c.echo = &buf },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if _, err := comfyMe.Exec("CREATE TABLE IF NOT EXISTS echoes (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO echoes (name) VALUES (?)", "echo"); err != nil {
+		t.Fatal(err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "CREATE TABLE IF NOT EXISTS echoes") {
+		t.Fatalf("expected create statement to be echoed, got %q", output)
+	}
+	if !strings.Contains(output, "INSERT INTO echoes (name) VALUES (?) -- args: [echo]") {
+		t.Fatalf("expected insert statement with args to be echoed, got %q", output)
+	}
+}
+
+func TestCommitHook(t *testing.T) {
+	var veto atomic.Bool
+	var rollbacks atomic.Int32
+	comfyMe, err := New(
+		WithMemory(),
+		WithCommitHook(func() int {
+			if veto.Load() {
+				return 1
+			}
+			return 0
+		}),
+		WithRollbackHook(func() {
+			rollbacks.Add(1)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if _, err := comfyMe.Exec("CREATE TABLE IF NOT EXISTS audited (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO audited (name) VALUES (?)", "accepted"); err != nil {
+		t.Fatal(err)
+	}
+
+	veto.Store(true)
+	if _, err := comfyMe.Exec("INSERT INTO audited (name) VALUES (?)", "vetoed"); err == nil {
+		t.Fatal("expected the commit hook to abort the insert")
+	}
+	veto.Store(false)
+
+	if rollbacks.Load() == 0 {
+		t.Fatal("expected the rollback hook to be called")
+	}
+
+	var count int
+	if err := comfyMe.QueryRow("SELECT COUNT(*) FROM audited").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 row, got %d", count)
+	}
+}
+
+func TestResult(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	data := errors.New("an error as data")
+	valueID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return data, nil
+	})
+	value, err := comfyMe.Result(valueID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if value != data {
+		t.Fatalf("expected the error value to be returned as data, got %v", value)
+	}
+
+	failure := errors.New("a failure")
+	failureID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return nil, failure
+	})
+	if _, err := comfyMe.Result(failureID); err != failure {
+		t.Fatalf("expected the failure, got %v", err)
+	}
+
+	if _, err := comfyMe.Result(failureID); err == nil {
+		t.Fatal("expected an error for a consumed workID")
+	}
+}
+
+func TestNewContext(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	// keep the worker busy
+	release := make(chan struct{})
+	busyID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var ran atomic.Bool
+	cancelledID := comfyMe.NewContext(ctx, func(db *sql.DB) (interface{}, error) {
+		ran.Store(true)
+		return nil, nil
+	})
+	cancel()
+
+	result, err := comfyMe.WaitFor(cancelledID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", result)
+	}
+
+	close(release)
+	<-comfyMe.WaitForChn(busyID)
+
+	doneID := comfyMe.NewContext(context.Background(), func(db *sql.DB) (interface{}, error) {
+		return "done", nil
+	})
+	if result := <-comfyMe.WaitForChn(doneID); result != "done" {
+		t.Fatalf("expected done, got %v", result)
+	}
+	if ran.Load() {
+		t.Fatal("expected the cancelled function to never run")
+	}
+}
+
+func TestJobTimeout(t *testing.T) {
+	comfyMe, err := New(WithMemory(), WithJobTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	// a job ignoring its deadline still gets its ticket timed out
+	release := make(chan struct{})
+	slowID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return "too late", nil
+	})
+	if _, err := comfyMe.Result(slowID); !errors.Is(err, ErrJobTimeout) {
+		t.Fatalf("expected ErrJobTimeout, got %v", err)
+	}
+	close(release)
+
+	// a query honoring the context is stopped by SQLite
+	start := time.Now()
+	recursiveID := comfyMe.NewWithTimeout(100*time.Millisecond, func(ctx context.Context, db *sql.DB) (interface{}, error) {
+		var count int
+		err := db.QueryRowContext(ctx, "WITH RECURSIVE forever(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM forever) SELECT COUNT(*) FROM forever").Scan(&count)
+		return count, err
+	})
+	if _, err := comfyMe.Result(recursiveID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	// and so is a query ignoring it, on the worker
+	ignoringID := comfyMe.NewWithTimeout(100*time.Millisecond, func(ctx context.Context, db *sql.DB) (interface{}, error) {
+		var count int
+		err := db.QueryRow("WITH RECURSIVE forever(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM forever) SELECT COUNT(*) FROM forever").Scan(&count)
+		return count, err
+	})
+	if _, err := comfyMe.Result(ignoringID); !errors.Is(err, ErrJobTimeout) {
+		t.Fatalf("expected ErrJobTimeout, got %v", err)
+	}
+
+	// the worker moves on
+	nextID := comfyMe.NewWithTimeout(0, func(ctx context.Context, db *sql.DB) (interface{}, error) {
+		return "next", nil
+	})
+	if value, err := comfyMe.Result(nextID); err != nil || value != "next" {
+		t.Fatalf("expected next, got %v %v", value, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the recursive query to be interrupted, took %v", elapsed)
+	}
+}
+
+var publishedMetrics atomic.Int32
+
+func TestMetrics(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	before := comfyMe.Metrics()
+
+	release := make(chan struct{})
+	busyID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	failingID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return nil, errors.New("failure")
+	})
+
+	// wait for the worker to pick up the busy job
+	for comfyMe.Metrics().Pending != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-comfyMe.WaitForChn(busyID)
+	<-comfyMe.WaitForChn(failingID)
+
+	after := comfyMe.Metrics()
+	if after.Pending != 0 {
+		t.Fatalf("expected no pending job, got %d", after.Pending)
+	}
+	if after.Executed-before.Executed != 2 {
+		t.Fatalf("expected 2 executed jobs, got %d", after.Executed-before.Executed)
+	}
+	if after.Errors-before.Errors != 1 {
+		t.Fatalf("expected 1 error, got %d", after.Errors-before.Errors)
+	}
+	if after.AverageDuration <= 0 {
+		t.Fatalf("expected an average duration, got %v", after.AverageDuration)
+	}
+	if after.P50Duration <= 0 || after.P99Duration < after.P95Duration || after.P95Duration < after.P50Duration {
+		t.Fatalf("expected ordered percentiles, got %v %v %v", after.P50Duration, after.P95Duration, after.P99Duration)
+	}
+	// the failing job waited behind the busy one
+	if after.MaxQueueWait < time.Millisecond || after.AverageQueueWait <= 0 {
+		t.Fatalf("expected the queue wait to be measured, got %v max %v", after.AverageQueueWait, after.MaxQueueWait)
+	}
+
+	// expvar panics when a name is published twice, with -count=2 for instance
+	name := fmt.Sprintf("%s_%d", t.Name(), publishedMetrics.Add(1))
+	comfyMe.PublishExpvar(name)
+	if published := expvar.Get(name).String(); !strings.Contains(published, `"Executed":`) {
+		t.Fatalf("expected the metrics on expvar, got %s", published)
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	ids := []uint64{}
+	for i := 0; i < 50; i++ {
+		ids = append(ids, comfyMe.New(func(db *sql.DB) (interface{}, error) {
+			return "drained", nil
+		}))
+	}
+
+	closed := make(chan error)
+	go func() {
+		closed <- comfyMe.Close()
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	if result := <-comfyMe.WaitForChn(comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return "accepted", nil
+	})); result != ErrClosed {
+		t.Fatalf("expected ErrClosed for a job submitted while closing, got %v", result)
+	}
+
+	close(release)
+	for _, id := range ids {
+		if result := <-comfyMe.WaitForChn(id); result != "drained" {
+			t.Fatalf("expected the queued job to be drained, got %v", result)
+		}
+	}
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryRowAfterClose(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := comfyMe.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := comfyMe.QueryRow("SELECT 1").Scan(&n); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from Scan, got %v", err)
+	}
+	if err := comfyMe.QueryRowContext(context.Background(), "SELECT 1").Scan(&n); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from Scan, got %v", err)
+	}
+}
+
+func TestCloseAbandonsEveryTicket(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	ids := []uint64{}
+	for i := 0; i < 100; i++ {
+		ids = append(ids, comfyMe.New(func(db *sql.DB) (interface{}, error) {
+			return "drained", nil
+		}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := comfyMe.CloseContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan interface{}, len(ids))
+	for _, id := range ids {
+		go func(id uint64) {
+			result, err := comfyMe.WaitFor(id)
+			if err != nil {
+				result = err
+			}
+			results <- result
+		}(id)
+	}
+	timeout := time.After(5 * time.Second)
+	for range ids {
+		select {
+		case result := <-results:
+			if err, ok := result.(error); !ok || !errors.Is(err, ErrClosed) {
+				t.Fatalf("expected ErrClosed, got %v", result)
+			}
+		case <-timeout:
+			t.Fatal("expected every WaitFor to return after Close")
+		}
+	}
+}
+
+func TestCloseContextAbandons(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	busyID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	ids := []uint64{}
+	for i := 0; i < 10; i++ {
+		ids = append(ids, comfyMe.New(func(db *sql.DB) (interface{}, error) {
+			return "drained", nil
+		}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	closed := make(chan error)
+	go func() {
+		closed <- comfyMe.CloseContext(ctx)
+	}()
+
+	for _, id := range append(ids, busyID) {
+		if result := <-comfyMe.WaitForChn(id); result != ErrClosed {
+			t.Fatalf("expected the job to be abandoned with ErrClosed, got %v", result)
+		}
+	}
+	close(release)
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	drained, err := New(WithPath(t.TempDir() + "/drained.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []uint64{}
+	for i := 0; i < 10; i++ {
+		ids = append(ids, drained.New(func(db *sql.DB) (interface{}, error) {
+			return "drained", nil
+		}))
+	}
+	if abandoned, err := drained.Shutdown(context.Background()); err != nil || abandoned != 0 {
+		t.Fatalf("expected the queue to be drained, got %d abandoned %v", abandoned, err)
+	}
+	for _, id := range ids {
+		if result := <-drained.WaitForChn(id); result != "drained" {
+			t.Fatalf("expected the job to run, got %v", result)
+		}
+	}
+
+	comfyMe, err := New(WithPath(t.TempDir() + "/abandoned.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	busyID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+	go func() {
+		// the connection closes once the abandoned job returns
+		<-comfyMe.WaitForChn(busyID)
+		close(release)
+	}()
+	for i := 0; i < 10; i++ {
+		comfyMe.New(func(db *sql.DB) (interface{}, error) {
+			return "drained", nil
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// the running job and the 10 queued behind it
+	if abandoned, err := comfyMe.Shutdown(ctx); err != nil || abandoned != 11 {
+		t.Fatalf("expected 11 abandoned jobs, got %d %v", abandoned, err)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	var handled atomic.Bool
+	comfyMe, err := New(
+		WithMemory(),
+		WithPanicHandler(func(v interface{}, stackTrace string) {
+			handled.Store(true)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	panicID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		var m map[string]int
+		m["boom"]++
+		return nil, nil
+	})
+	_, err = comfyMe.Result(panicID)
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected a PanicError, got %v", err)
+	}
+	if !strings.Contains(panicErr.Stack, "TestPanicRecovery") {
+		t.Fatalf("expected the stack to point at the test, got %s", panicErr.Stack)
+	}
+	if !handled.Load() {
+		t.Fatal("expected the panic handler to be called")
+	}
+
+	laterID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return "still alive", nil
+	})
+	if value, err := comfyMe.Result(laterID); err != nil || value != "still alive" {
+		t.Fatalf("expected the worker to keep processing, got %v %v", value, err)
+	}
+}
+
+func TestBusyRetry(t *testing.T) {
+	path := t.TempDir() + "/busy.db"
+	conn := fmt.Sprintf("file:%s?mode=rwc&_journal_mode=WAL&_timeout=0", path)
+
+	comfyMe, err := New(WithConnection(conn), WithBusyRetry(10, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	createID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return db.Exec("CREATE TABLE busy (id INTEGER PRIMARY KEY)")
+	})
+	if _, err := comfyMe.Result(createID); err != nil {
+		t.Fatal(err)
+	}
+
+	// another process holding the write lock for a while
+	other, err := sql.Open("sqlite3", conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	other.SetMaxOpenConns(1)
+	if _, err := other.Exec("BEGIN IMMEDIATE"); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(100*time.Millisecond, func() {
+		other.Exec("COMMIT")
+	})
+
+	var attempts atomic.Int32
+	insertID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		attempts.Add(1)
+		return db.Exec("INSERT INTO busy (id) VALUES (1)")
+	})
+	if _, err := comfyMe.Result(insertID); err != nil {
+		t.Fatalf("expected the insert to succeed once the lock is released, got %v", err)
+	}
+	if attempts.Load() < 2 {
+		t.Fatalf("expected the job to be retried, ran %d times", attempts.Load())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	for _, tc := range []struct {
+		maxAttempts int
+		retries     int
+	}{{3, 2}, {1, 0}, {0, 0}} {
+		comfyMe := &ComfyDB{}
+		WithRetry(tc.maxAttempts, time.Millisecond)(comfyMe)
+		if comfyMe.busyRetries != tc.retries || comfyMe.busyBackoff != time.Millisecond {
+			t.Fatalf("expected %d attempts to be %d retries, got %d", tc.maxAttempts, tc.retries, comfyMe.busyRetries)
+		}
+	}
+}
+
+func TestWAL(t *testing.T) {
+	conn := fmt.Sprintf("file:%s?mode=rwc", t.TempDir()+"/wal.db")
+	comfyMe, err := New(WithConnection(conn), WithWAL(), WithSynchronous("full"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	mode, err := comfyMe.GetPragma("journal_mode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Fatalf("expected wal, got %s", mode)
+	}
+	synchronous, err := comfyMe.GetPragma("synchronous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synchronous != "2" {
+		t.Fatalf("expected synchronous FULL (2), got %s", synchronous)
+	}
+
+	if _, err := New(WithMemory(), WithWAL()); err == nil {
+		t.Fatal("expected an error enabling WAL on an in-memory database")
+	}
+	if _, err := New(WithMemory(), WithSynchronous("sometimes")); err == nil {
+		t.Fatal("expected an error for an invalid synchronous mode")
+	}
+}
+
+func TestJournalMode(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir()+"/journal.db"), WithJournalMode("truncate"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	var mode string
+	if err := comfyMe.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "truncate" {
+		t.Fatalf("expected journal mode truncate, got %q %v", mode, err)
+	}
+	if _, err := New(WithMemory(), WithJournalMode("sometimes")); err == nil {
+		t.Fatal("expected an error for an invalid journal mode")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	migrations := []Migration{
+		NewMigration(1, "create_pets", func(tx *sql.Tx) error {
+			_, err := tx.Exec("CREATE TABLE pets (id INTEGER PRIMARY KEY)")
+			return err
+		}, func(tx *sql.Tx) error {
+			_, err := tx.Exec("DROP TABLE pets")
+			return err
+		}),
+		NewMigration(5, "add_pets_name", func(tx *sql.Tx) error {
+			_, err := tx.Exec("ALTER TABLE pets ADD COLUMN name TEXT")
+			return err
+		}, func(tx *sql.Tx) error {
+			_, err := tx.Exec("ALTER TABLE pets DROP COLUMN name")
+			return err
+		}),
+		NewMigration(9, "create_owners", func(tx *sql.Tx) error {
+			_, err := tx.Exec("CREATE TABLE owners (id INTEGER PRIMARY KEY)")
+			return err
+		}, func(tx *sql.Tx) error {
+			_, err := tx.Exec("DROP TABLE owners")
+			return err
+		}),
+	}
+
+	// at every startup
+	for i := 0; i < 2; i++ {
+		if err := comfyMe.Migrate(migrations); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if version, err := comfyMe.Version(); err != nil || version != 9 {
+		t.Fatalf("expected version 9, got %v %v", version, err)
+	}
+
+	if err := comfyMe.MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := comfyMe.Version(); err != nil || version != 1 {
+		t.Fatalf("expected version 1, got %v %v", version, err)
+	}
+	if columns, err := comfyMe.ShowColumns("pets"); err != nil || len(columns) != 1 {
+		t.Fatalf("expected the name column to be rolled back, got %v %v", columns, err)
+	}
+
+	conflicting := []Migration{NewMigration(5, "something_else", migrations[1].Up, migrations[1].Down)}
+	if err := comfyMe.Migrate(conflicting); err == nil {
+		t.Fatal("expected an error for conflicting migrations")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	release := make(chan struct{})
+	blockingID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	var ran atomic.Bool
+	queuedID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		ran.Store(true)
+		return nil, nil
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	if comfyMe.Cancel(blockingID) {
+		t.Fatal("expected a running job not to be cancellable")
+	}
+	if !comfyMe.Cancel(queuedID) {
+		t.Fatal("expected the queued job to be cancelled")
+	}
+	if comfyMe.Cancel(queuedID) {
+		t.Fatal("expected a job to be cancelled only once")
+	}
+	close(release)
+
+	if _, err := comfyMe.Result(queuedID); !errors.Is(err, ErrCanceled) {
+		t.Fatalf("expected ErrCanceled, got %v", err)
+	}
+	if _, err := comfyMe.Result(blockingID); err != nil {
+		t.Fatal(err)
+	}
+	if ran.Load() {
+		t.Fatal("expected the cancelled job not to run")
+	}
+}
+
+func TestPingContext(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if err := comfyMe.PingContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	stuckID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	defer comfyMe.WaitFor(stuckID)
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = comfyMe.PingContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "pending") {
+		t.Fatalf("expected the stuck worker to be reported, got %v", err)
+	}
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := db.PingContext(ctx); err == nil {
+		t.Fatal("expected the driver ping to probe the worker")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	events := make(chan QueryEvent, 16)
+	comfyMe, err := New(WithMemory(), WithLogger(func(event QueryEvent) {
+		events <- event
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	<-events // the migration table
+
+	jobID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return nil, errors.New("failure")
+	})
+	comfyMe.WaitFor(jobID)
+	if event := <-events; event.ID != jobID || event.Query != "" || event.Err == nil {
+		t.Fatalf("expected the failed job to be logged, got %+v", event)
+	}
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("SELECT ?, ?", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	for event := range events {
+		if event.Query == "SELECT ?, ?" {
+			if event.Args != 2 || event.Err != nil || event.Start.IsZero() {
+				t.Fatalf("unexpected event %+v", event)
+			}
+			break
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if event := <-events; event.Query != "SELECT 1" {
+		t.Fatalf("expected the statement of the transaction, got %+v", event)
+	}
+	if event := <-events; event.Query != "COMMIT" {
+		t.Fatalf("expected the commit, got %+v", event)
+	}
+}
+
+func TestHook(t *testing.T) {
+	var mu sync.Mutex
+	calls := []string{}
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	comfyMe, err := New(
+		WithPath(t.TempDir()+"/hooks.db"),
+		WithHook(func(info JobInfo) {
+			record("before " + info.Query)
+		}, func(info JobInfo, result interface{}, err error, duration time.Duration) {
+			record(fmt.Sprintf("after %s %v %v", info.Query, result, err != nil))
+		}),
+		WithHook(nil, func(info JobInfo, result interface{}, err error, duration time.Duration) {
+			if info.Priority == 7 {
+				record("second")
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	jobID := comfyMe.NewWithPriority(7, func(db *sql.DB) (interface{}, error) {
+		return "done", nil
+	})
+	if _, err := comfyMe.Result(jobID); err != nil {
+		t.Fatal(err)
+	}
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("SELECT missing"); err == nil {
+		t.Fatal("expected the statement to fail")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	got := strings.Join(calls, "|")
+	for _, want := range []string{
+		"before |after  done false|second",
+		"before SELECT missing|after SELECT missing <nil> true",
+		"before SELECT 1|after SELECT 1",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in the hook calls, got %q", want, got)
+		}
+	}
+}
+
+func TestSlowQueryThreshold(t *testing.T) {
+	slow := make(chan SlowQuery, 4)
+	comfyMe, err := New(WithPath(t.TempDir()+"/slow.db"), WithSlowQueryThreshold(20*time.Millisecond, func(query SlowQuery) {
+		slow <- query
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if err := comfyMe.RegisterFunc("pause", func(ms int) int {
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		return ms
+	}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SELECT pause(30)"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case query := <-slow:
+		if query.Query != "SELECT pause(30)" || query.Duration < 30*time.Millisecond {
+			t.Fatalf("expected the slow statement, got %+v", query)
+		}
+	default:
+		t.Fatal("expected the slow statement to be reported")
+	}
+	if len(slow) != 0 {
+		t.Fatalf("expected only the slow statement to be reported, got %+v", <-slow)
+	}
+}
+
+// another driver, under another name: sql.Register panics when called twice, with -count=2 for instance
+var registerTestDriver sync.Once
+
+func TestWithDriver(t *testing.T) {
+	registerTestDriver.Do(func() {
+		sql.Register("comfylite3_test_driver", &sqlite3.SQLiteDriver{})
+	})
+	comfyMe, err := New(WithPath(t.TempDir()+"/driver.db"), WithDriver("comfylite3_test_driver"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if _, err := comfyMe.Exec("CREATE TABLE pets (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	if _, err := db.Exec("INSERT INTO pets VALUES ('rex')"); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := comfyMe.QueryRow("SELECT COUNT(*) FROM pets").Scan(&count); err != nil || count != 1 {
+		t.Fatalf("expected 1 row, got %d %v", count, err)
+	}
+
+	if err := comfyMe.RegisterFunc("double", func(n int) int { return n * 2 }, true); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestPoolSettersForget(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/pool.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	count := func() int {
+		n := 0
+		comfyMe.results.Range(func(_, _ interface{}) bool {
+			n++
+			return true
+		})
+		return n
+	}
+	before := count()
+	comfyMe.SetConnMaxIdleTime(time.Minute)
+	comfyMe.SetConnMaxLifetime(time.Hour)
+	comfyMe.SetMaxIdleConns(1)
+	comfyMe.SetMaxOpenConns(1)
+	if after := count(); after != before {
+		t.Fatalf("expected the setters to forget their results, %d kept", after-before)
+	}
+}
+
+func TestWithPragmas(t *testing.T) {
+	mattn := &ComfyDB{driver: "sqlite3"}
+	if dsn := mattn.withPragmas("file:a.db?mode=ro", "busy_timeout=5000"); dsn != "file:a.db?mode=ro&_busy_timeout=5000" {
+		t.Fatalf("unexpected connection string %s", dsn)
+	}
+	other := &ComfyDB{driver: "sqlite"}
+	if dsn := other.withPragmas("file:a.db", "journal_mode=WAL", "busy_timeout=5000"); dsn != "file:a.db?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)" {
+		t.Fatalf("unexpected connection string %s", dsn)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir()+"/reopen.db"), WithQueueWhileClosed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if err := comfyMe.RegisterFunc("double", func(n int) int { return n * 2 }, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := comfyMe.SetPragma("foreign_keys", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("CREATE TABLE reopened (n INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := comfyMe.Reopen(); err == nil {
+		t.Fatal("expected Reopen to fail on an open database")
+	}
+
+	if err := comfyMe.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// waits for Reopen
+	parkedID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return db.Exec("INSERT INTO reopened (n) VALUES (double(21))")
+	})
+	if err := comfyMe.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Result(parkedID); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := comfyMe.QueryRow("SELECT n FROM reopened").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 42 {
+		t.Fatalf("expected 42, got %d", n)
+	}
+	foreignKeys, err := comfyMe.GetPragma("foreign_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foreignKeys != "1" {
+		t.Fatalf("expected foreign_keys to be applied again, got %s", foreignKeys)
+	}
+}
+
+func TestClosedWithoutQueue(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/closed.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if err := comfyMe.Close(); err != nil {
+		t.Fatal(err)
+	}
+	closedID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return nil, nil
+	})
+	if _, err := comfyMe.Result(closedID); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if err := comfyMe.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.ShowTables(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	ids := comfyMe.NewBatch([]func(db *sql.DB) (interface{}, error){
+		func(db *sql.DB) (interface{}, error) { return 1, nil },
+		func(db *sql.DB) (interface{}, error) { return nil, errors.New("second failed") },
+		func(db *sql.DB) (interface{}, error) {
+			var n int
+			err := db.QueryRow("SELECT 3").Scan(&n)
+			return n, err
+		},
+	})
+	if len(ids) != 3 || ids[0] >= ids[1] || ids[1] >= ids[2] {
+		t.Fatalf("expected 3 ids in submission order, got %v", ids)
+	}
+
+	results := comfyMe.WaitForAll(ids...)
+	if results[0] != 1 || results[2] != 3 {
+		t.Fatalf("unexpected results %v", results)
+	}
+	if err, ok := results[1].(error); !ok || err.Error() != "second failed" {
+		t.Fatalf("expected the error of the second job in its slot, got %v", results[1])
+	}
+	if again := comfyMe.WaitForAll(ids[0])[0]; again != 1 {
+		t.Fatalf("expected the result to be kept, got %v", again)
+	}
+	comfyMe.Forget(ids[0])
+	if err, ok := comfyMe.WaitForAll(ids[0])[0].(error); !ok || err.Error() != "workID not found" {
+		t.Fatalf("expected a forgotten ticket to fail in its slot, got %v", err)
+	}
+}
+
+func TestWaitForCtx(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	blockingID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	queuedID := comfyMe.NewContext(ctx, func(db *sql.DB) (interface{}, error) {
+		return "ran", nil
+	})
+
+	waitCtx, stopWaiting := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stopWaiting()
+	if _, err := comfyMe.WaitForCtx(waitCtx, blockingID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to stop waiting with the context, got %v", err)
+	}
+
+	cancel()
+	if result, err := comfyMe.WaitForCtx(context.Background(), queuedID); err != nil || result != context.Canceled {
+		t.Fatalf("expected the queued job to be dropped, got %v %v", result, err)
+	}
+	close(release)
+	if result, err := comfyMe.WaitForCtx(context.Background(), blockingID); err != nil || result != nil {
+		t.Fatalf("expected the job to go on, got %v %v", result, err)
+	}
+}
+
+func TestWaitForTimeoutAndPoll(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	release := make(chan struct{})
+	blockingID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return "done", nil
+	})
+	if _, err := comfyMe.WaitForTimeout(blockingID, 20*time.Millisecond); !errors.Is(err, ErrWaitTimeout) {
+		t.Fatalf("expected ErrWaitTimeout, got %v", err)
+	}
+	if result, done, err := comfyMe.Poll(blockingID); err != nil || done || result != nil {
+		t.Fatalf("expected the job to be pending, got %v %v %v", result, done, err)
+	}
+
+	close(release)
+	if result, err := comfyMe.WaitForTimeout(blockingID, time.Second); err != nil || result != "done" {
+		t.Fatalf("expected the result, got %v %v", result, err)
+	}
+	if result, done, err := comfyMe.Poll(blockingID); err != nil || !done || result != "done" {
+		t.Fatalf("expected the job to be done, got %v %v %v", result, done, err)
+	}
+	comfyMe.Forget(blockingID)
+	if _, _, err := comfyMe.Poll(blockingID); err == nil {
+		t.Fatal("expected an error for a forgotten workID")
+	}
+}
+
+func TestWaitAny(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir()+"/any.db"), WithReaders(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	release := make(chan struct{})
+	slowID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return "slow", nil
+	})
+	defer close(release)
+	fastID := comfyMe.NewRead(func(db *sql.DB) (interface{}, error) {
+		return "fast", nil
+	})
+	id, result, err := comfyMe.WaitAny(slowID, fastID)
+	if err != nil || id != fastID || result != "fast" {
+		t.Fatalf("expected the fast job first, got %d %v %v", id, result, err)
+	}
+	if _, _, err := comfyMe.WaitAny(); err == nil {
+		t.Fatal("expected an error without workID")
+	}
+	if _, _, err := comfyMe.WaitAny(slowID, 1<<40); err == nil {
+		t.Fatal("expected an error for an unknown workID")
+	}
+}
+
+func TestManyWaiters(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	release := make(chan struct{})
+	id := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return 42, nil
+	})
+
+	var wg sync.WaitGroup
+	results := make(chan interface{}, 10)
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			result, err := comfyMe.WaitFor(id)
+			if err != nil {
+				result = err
+			}
+			results <- result
+		}()
+		go func() {
+			defer wg.Done()
+			results <- <-comfyMe.WaitForChn(id)
+		}()
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+	for result := range results {
+		if result != 42 {
+			t.Fatalf("expected every waiter to get 42, got %v", result)
+		}
+	}
+
+	if result, err := comfyMe.Result(id); err != nil || result != 42 {
+		t.Fatalf("expected a late waiter to get the kept result, got %v, %v", result, err)
+	}
+	comfyMe.Forget(id)
+	if _, err := comfyMe.WaitFor(id); err == nil || err.Error() != "workID not found" {
+		t.Fatalf("expected a forgotten workID to be gone, got %v", err)
+	}
+}
+
+func TestCreateDir(t *testing.T) {
+	path := t.TempDir() + "/data/nested/app.db"
+	if _, err := New(WithPath(path)); err == nil || !strings.Contains(err.Error(), "WithCreateDir") {
+		t.Fatalf("expected a clear error for the missing directory, got %v", err)
+	}
+
+	comfyMe, err := New(WithPath(path), WithCreateDir(0o755))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if _, err := comfyMe.Exec("CREATE TABLE created (n INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the database file to be created: %v", err)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir()+"/flush.db"), WithWAL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if _, err := comfyMe.Exec("CREATE TABLE pets (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		comfyMe.New(func(db *sql.DB) (interface{}, error) {
+			return db.Exec("INSERT INTO pets (name) VALUES ('rex')")
+		})
+	}
+	if err := comfyMe.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	readDB, err := OpenReadDB(comfyMe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readDB.Close()
+	var count int
+	if err := readDB.QueryRow("SELECT COUNT(*) FROM pets").Scan(&count); err != nil || count != 20 {
+		t.Fatalf("expected the 20 writes to be visible, got %d %v", count, err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := comfyMe.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestFlushNewAfter(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/flush.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	release := make(chan struct{})
+	depID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	var ran atomic.Bool
+	afterID := comfyMe.NewAfter(depID, func(db *sql.DB) (interface{}, error) {
+		time.Sleep(50 * time.Millisecond)
+		ran.Store(true)
+		return nil, nil
+	})
+	flushed := make(chan error, 1)
+	go func() {
+		flushed <- comfyMe.Flush(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	// the dependent job wasn't in the queue yet when Flush began
+	if !ran.Load() {
+		t.Fatal("expected Flush to wait for the job of NewAfter")
+	}
+	if _, err := comfyMe.WaitFor(afterID); err != nil {
+		t.Fatal(err)
+	}
+}
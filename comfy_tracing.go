@@ -0,0 +1,53 @@
+package comfylite3
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer starts a span for every job and every statement of a transaction opened through OpenDB, see WithTracing.
+// It is small enough to adapt any tracing library, OpenTelemetry included, without comfylite3 depending on it.
+type Tracer interface {
+	// StartJob is called when the job starts running, with the context it was submitted with: the one of NewContext,
+	// DoContext or the OpenDB calls, context.Background otherwise. end is called once the job ran, with its error.
+	StartJob(ctx context.Context, info JobInfo, queueWait time.Duration) (end func(err error))
+}
+
+// WithTracing reports the jobs to tracer. JobInfo.Query goes through redact first when it's not nil,
+// to keep literals out of the spans.
+func WithTracing(tracer Tracer, redact func(query string) string) ComfyOption {
+	return func(c *ComfyDB) {
+		c.tracer = tracer
+		c.redact = redact
+	}
+}
+
+// Start the span of a job, a no-op without WithTracing. The tracer's panics go to WithPanicHandler like the hooks'.
+func (c *ComfyDB) startSpan(ctx context.Context, info JobInfo, queueWait time.Duration) func(err error) {
+	if c.tracer == nil {
+		return func(error) {}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if c.redact != nil && info.Query != "" {
+		// a panicking redact leaves the query out rather than in the clear
+		query := info.Query
+		info.Query = ""
+		c.callHook(func() {
+			info.Query = c.redact(query)
+		})
+	}
+	var end func(err error)
+	c.callHook(func() {
+		end = c.tracer.StartJob(ctx, info, queueWait)
+	})
+	if end == nil {
+		return func(error) {}
+	}
+	return func(err error) {
+		c.callHook(func() {
+			end(err)
+		})
+	}
+}
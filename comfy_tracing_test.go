@@ -0,0 +1,122 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type traceKey struct{}
+
+// Spans kept in memory.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (r *recordingTracer) StartJob(ctx context.Context, info JobInfo, queueWait time.Duration) func(err error) {
+	parent, _ := ctx.Value(traceKey{}).(string)
+	return func(err error) {
+		outcome := "ok"
+		if err != nil {
+			outcome = "error"
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.spans = append(r.spans, parent+":"+info.Query+":"+outcome)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	comfyMe, err := New(
+		WithPath(t.TempDir()+"/traced.db"),
+		WithTracing(tracer, func(query string) string {
+			return strings.ReplaceAll(query, "'secret'", "?")
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	ctx := context.WithValue(context.Background(), traceKey{}, "request")
+	if _, err := db.ExecContext(ctx, "CREATE TABLE users (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "SELECT missing"); err == nil {
+		t.Fatal("expected the statement to fail")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO users VALUES ('secret')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	got := strings.Join(tracer.spans, "|")
+	for _, want := range []string{
+		"request:CREATE TABLE users (name TEXT):ok",
+		"request:SELECT missing:error",
+		"request:INSERT INTO users VALUES (?):ok",
+		":COMMIT:ok",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected the span %q, got %q", want, got)
+		}
+	}
+}
+
+// Tracer panicking when the span starts or ends.
+type panickingTracer struct {
+	onEnd bool
+}
+
+func (p panickingTracer) StartJob(ctx context.Context, info JobInfo, queueWait time.Duration) func(err error) {
+	if !p.onEnd {
+		panic("start")
+	}
+	return func(err error) {
+		panic("end")
+	}
+}
+
+func TestTracingPanic(t *testing.T) {
+	for _, tracer := range []panickingTracer{{onEnd: false}, {onEnd: true}} {
+		var panics atomic.Int32
+		comfyMe, err := New(
+			WithPath(t.TempDir()+"/traced.db"),
+			WithTracing(tracer, nil),
+			WithPanicHandler(func(r interface{}, stack string) {
+				panics.Add(1)
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			id := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+				return "done", nil
+			})
+			if value, err := comfyMe.Result(id); err != nil || value != "done" {
+				t.Fatalf("expected the worker to survive the tracer, got %v %v", value, err)
+			}
+		}
+		if panics.Load() == 0 {
+			t.Fatal("expected the panics of the tracer to reach the panic handler")
+		}
+		comfyMe.Close()
+	}
+}
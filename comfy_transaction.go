@@ -0,0 +1,28 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Transaction runs fn inside a transaction, as a single job bound to ctx like NewContext:
+// the transaction commits when fn returns nil and rolls back when it returns an error or panics.
+// fn's error is returned as is, a panic comes back as a *PanicError.
+// Nothing else runs on the worker meanwhile: fn must not wait for another job.
+// It waits as long as fn runs; once ctx is done it returns ctx.Err() right away, the transaction can't commit anymore.
+func (c *ComfyDB) Transaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	txID := c.newContext(ctx, func(jobCtx context.Context, db *sql.DB) (interface{}, error) {
+		tx, err := db.BeginTx(jobCtx, nil)
+		if err != nil {
+			return nil, err
+		}
+		// a no-op once committed
+		defer tx.Rollback()
+		if err := fn(tx); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	})
+	_, err := c.awaitResult(ctx, txID)
+	return err
+}
@@ -0,0 +1,110 @@
+package comfylite3
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	comfyMe, err := New(WithMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	if _, err := comfyMe.Exec("CREATE TABLE IF NOT EXISTS transfers (amount INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("DELETE FROM transfers"); err != nil {
+		t.Fatal(err)
+	}
+	count := func() int {
+		t.Helper()
+		var count int
+		if err := comfyMe.QueryRow("SELECT COUNT(*) FROM transfers").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+	ctx := context.Background()
+
+	if err := comfyMe.Transaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO transfers VALUES (1), (2)")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if count() != 2 {
+		t.Fatal("expected the transaction to commit")
+	}
+
+	failure := errors.New("insufficient funds")
+	if err := comfyMe.Transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO transfers VALUES (3)"); err != nil {
+			return err
+		}
+		return failure
+	}); !errors.Is(err, failure) {
+		t.Fatalf("expected the error of the function, got %v", err)
+	}
+
+	var panicErr *PanicError
+	if err := comfyMe.Transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO transfers VALUES (4)"); err != nil {
+			return err
+		}
+		panic("boom")
+	}); !errors.As(err, &panicErr) {
+		t.Fatalf("expected a PanicError, got %v", err)
+	}
+	if count() != 2 {
+		t.Fatal("expected the failed transactions to roll back")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := comfyMe.Transaction(cancelled, func(tx *sql.Tx) error {
+		t.Fatal("expected the transaction to be dropped")
+		return nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+}
+
+func TestTransactionCancelledWhileRunning(t *testing.T) {
+	comfyMe, err := New(WithPath(t.TempDir() + "/transaction.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if _, err := comfyMe.Exec("CREATE TABLE transfers (amount INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// cancelled while running: Transaction returns without waiting for fn, which can't commit anymore
+	running, cancelRunning := context.WithCancel(ctx)
+	started, release := make(chan struct{}), make(chan struct{})
+	go func() {
+		<-started
+		cancelRunning()
+	}()
+	if err := comfyMe.Transaction(running, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO transfers VALUES (5)"); err != nil {
+			return err
+		}
+		close(started)
+		<-release
+		return nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	close(release)
+	var count int
+	if err := comfyMe.QueryRow("SELECT COUNT(*) FROM transfers").Scan(&count); err != nil || count != 0 {
+		t.Fatalf("expected the cancelled transaction to roll back, got %d %v", count, err)
+	}
+}
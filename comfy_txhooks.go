@@ -0,0 +1,111 @@
+package comfylite3
+
+import (
+	"sync"
+)
+
+// Transaction that ended on the worker connection, waiting for its OnCommit or OnRollback callbacks.
+type txEvent struct {
+	committed bool
+	explicit  bool // opened by BEGIN or SAVEPOINT rather than by a single statement
+}
+
+// State shared by SQLite's hooks, which run inside the statements of the connection.
+type txTracker struct {
+	mu       sync.Mutex
+	explicit bool // the transaction in progress wrote outside autocommit mode
+	events   []txEvent
+}
+
+func (t *txTracker) record(committed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, txEvent{committed: committed, explicit: t.explicit})
+	t.explicit = false
+}
+
+func (t *txTracker) drain() []txEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := t.events
+	t.events = nil
+	return events
+}
+
+// OnCommit registers fn to be called after a transaction commits: one of OpenDB, or a job running its own BEGIN/COMMIT.
+// The functions run on the worker, in the order the transactions committed then in the order they were registered,
+// before the job or the Commit that committed returns. Like WithCommitHook, they must not wait for a job.
+//
+// Single statements committing on their own don't call them, unless WithAutocommitHooks says otherwise.
+// Only transactions that changed something are reported.
+func (c *ComfyDB) OnCommit(fn func()) {
+	c.txHooksMu.Lock()
+	defer c.txHooksMu.Unlock()
+	c.onCommit = append(c.onCommit, fn)
+}
+
+// OnRollback registers fn to be called after a transaction rolls back, see OnCommit.
+// That includes the transactions of OpenDB rolled back by WithTxTimeout or Close, and the commits vetoed by WithCommitHook.
+func (c *ComfyDB) OnRollback(fn func()) {
+	c.txHooksMu.Lock()
+	defer c.txHooksMu.Unlock()
+	c.onRollback = append(c.onRollback, fn)
+}
+
+// WithAutocommitHooks also calls the OnCommit and OnRollback functions for single statements committing on their own.
+func WithAutocommitHooks() ComfyOption {
+	return func(c *ComfyDB) {
+		c.autocommitHooks = true
+	}
+}
+
+// Connect hook behind WithCommitHook, WithRollbackHook, OnCommit, OnRollback and OnChange: SQLite has a single slot for each hook.
+func (c *ComfyDB) txHook(conn *rawConn) error {
+	conn.RegisterUpdateHook(func(op int, database, table string, rowid int64) {
+		if !conn.AutoCommit() {
+			c.tx.mu.Lock()
+			c.tx.explicit = true
+			c.tx.mu.Unlock()
+		}
+		c.fireChange(op, table, rowid)
+	})
+	conn.RegisterCommitHook(func() int {
+		if c.commitHook != nil {
+			if veto := c.commitHook(); veto != 0 {
+				return veto
+			}
+		}
+		c.tx.record(true)
+		return 0
+	})
+	conn.RegisterRollbackHook(func() {
+		if c.rollbackHook != nil {
+			c.rollbackHook()
+		}
+		c.tx.record(false)
+	})
+	return nil
+}
+
+// Call the OnCommit and OnRollback functions for the transactions that ended, from the worker.
+func (c *ComfyDB) fireTxHooks() {
+	events := c.tx.drain()
+	if len(events) == 0 {
+		return
+	}
+	c.txHooksMu.RLock()
+	onCommit, onRollback := c.onCommit, c.onRollback
+	c.txHooksMu.RUnlock()
+	for _, event := range events {
+		if !event.explicit && !c.autocommitHooks {
+			continue
+		}
+		fns := onRollback
+		if event.committed {
+			fns = onCommit
+		}
+		for _, fn := range fns {
+			c.callHook(fn)
+		}
+	}
+}
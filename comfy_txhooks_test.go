@@ -0,0 +1,158 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOnCommit(t *testing.T) {
+	comfyMe, err := New(WithPath(filepath.Join(t.TempDir(), "events.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	var mu sync.Mutex
+	events := []string{}
+	comfyMe.OnCommit(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, "commit")
+	})
+	comfyMe.OnRollback(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, "rollback")
+	})
+	expect := func(expected ...string) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		if len(events) != len(expected) || len(events) > 0 && !reflect.DeepEqual(events, expected) {
+			t.Fatalf("expected %v, got %v", expected, events)
+		}
+		events = events[:0]
+	}
+
+	if _, err := comfyMe.Exec("CREATE TABLE events (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO events VALUES ('autocommit')"); err != nil {
+		t.Fatal(err)
+	}
+	expect()
+
+	db := OpenDB(comfyMe)
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO events VALUES ('committed')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expect("commit")
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO events VALUES ('rolled back')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	expect("rollback")
+
+	jobID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		tx, err := db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("INSERT INTO events VALUES ('job')"); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		return nil, tx.Commit()
+	})
+	if _, err := comfyMe.Result(jobID); err != nil {
+		t.Fatal(err)
+	}
+	expect("commit")
+}
+
+func TestAutocommitHooks(t *testing.T) {
+	comfyMe, err := New(WithPath(filepath.Join(t.TempDir(), "autocommit.db")), WithAutocommitHooks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	commits := 0
+	comfyMe.OnCommit(func() { commits++ })
+	if _, err := comfyMe.Exec("CREATE TABLE autocommitted (n INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comfyMe.Exec("INSERT INTO autocommitted VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	// read on the worker, after the callbacks
+	countID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		return commits, nil
+	})
+	count, err := comfyMe.Result(countID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.(int) != 2 {
+		t.Fatalf("expected 2 commits, got %v", count)
+	}
+}
+
+func TestHookPanic(t *testing.T) {
+	var panics atomic.Int32
+	comfyMe, err := New(
+		WithPath(filepath.Join(t.TempDir(), "panics.db")),
+		WithPanicHandler(func(v interface{}, stackTrace string) {
+			panics.Add(1)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+	if _, err := comfyMe.Exec("CREATE TABLE pets (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	comfyMe.OnCommit(func() { panic("commit") })
+	comfyMe.OnChange(func(op ChangeOp, table string, rowid int64) { panic("change") })
+
+	txID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		if _, err := db.Exec("BEGIN"); err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec("INSERT INTO pets (name) VALUES ('rex')"); err != nil {
+			return nil, err
+		}
+		return db.Exec("COMMIT")
+	})
+	if _, err := comfyMe.Result(txID); err != nil {
+		t.Fatalf("expected the job to keep its outcome, got %v", err)
+	}
+	if n := panics.Load(); n != 2 {
+		t.Fatalf("expected 2 panics handled, got %d", n)
+	}
+
+	var count int
+	if err := comfyMe.QueryRow("SELECT COUNT(*) FROM pets").Scan(&count); err != nil || count != 1 {
+		t.Fatalf("expected the worker to keep going, got %d %v", count, err)
+	}
+}
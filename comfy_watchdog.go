@@ -0,0 +1,84 @@
+package comfylite3
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// HangReport describes a job running on the worker for longer than the delay of WithWatchdog.
+type HangReport struct {
+	ID      uint64        // ticket of the job
+	Running time.Duration // how long it has been running
+	Stack   string        // stack of the worker goroutine
+}
+
+// Job the worker is running, watched by WithWatchdog.
+type runningJob struct {
+	id       uint64
+	start    time.Time
+	reported atomic.Bool
+}
+
+// WithWatchdog reports the jobs running on the worker for longer than d: every other job is stuck behind them.
+// The report is logged as a warning to the logger of WithSlog, with the ticket and the stack of the worker, then passed to onHang
+// when it's not nil, to alert or crash on purpose. Each job is reported once.
+//
+// It's a diagnostic tool: the job keeps running. A transaction of OpenDB holds the worker for its whole life and is
+// reported like any job, as long as it stays open.
+func WithWatchdog(d time.Duration, onHang func(HangReport)) ComfyOption {
+	return func(c *ComfyDB) {
+		c.watchdog = d
+		c.onHang = onHang
+	}
+}
+
+// Check the running job every quarter of the delay until the worker stops.
+func (c *ComfyDB) watch(stopped <-chan struct{}) {
+	ticker := time.NewTicker(c.watchdog / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+		job := c.running.Load()
+		if job == nil {
+			continue
+		}
+		running := time.Since(job.start)
+		if running < c.watchdog || !job.reported.CompareAndSwap(false, true) {
+			continue
+		}
+		report := HangReport{ID: job.id, Running: running, Stack: goroutineStack(c.workerID.Load())}
+		c.warnings().Warn("comfylite3: job is blocking the worker", "id", report.ID, "running", report.Running, "stack", report.Stack)
+		if c.onHang != nil {
+			c.onHang(report)
+		}
+	}
+}
+
+// Identifier of the calling goroutine, from its stack header.
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	var id uint64
+	fmt.Sscanf(string(buf), "goroutine %d ", &id)
+	return id
+}
+
+// Stack of the goroutine with the given identifier, empty if it's gone.
+func goroutineStack(id uint64) string {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	header := []byte(fmt.Sprintf("goroutine %d [", id))
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, header) {
+			return string(stack)
+		}
+	}
+	return ""
+}
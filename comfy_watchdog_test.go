@@ -0,0 +1,48 @@
+package comfylite3
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	reports := make(chan HangReport, 1)
+	comfyMe, err := New(WithMemory(), WithWatchdog(40*time.Millisecond, func(report HangReport) {
+		reports <- report
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfyMe.Close()
+
+	stuckID := comfyMe.New(func(db *sql.DB) (interface{}, error) {
+		time.Sleep(200 * time.Millisecond)
+		return nil, nil
+	})
+
+	select {
+	case report := <-reports:
+		if report.ID != stuckID {
+			t.Fatalf("expected job %d to be reported, got %d", stuckID, report.ID)
+		}
+		if report.Running < 40*time.Millisecond {
+			t.Fatalf("reported too early, after %v", report.Running)
+		}
+		if !strings.Contains(report.Stack, "time.Sleep") {
+			t.Fatalf("expected the stack of the worker, got:\n%s", report.Stack)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the stuck job to be reported")
+	}
+
+	if _, err := comfyMe.Result(stuckID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case report := <-reports:
+		t.Fatalf("expected a single report, got another for %d", report.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
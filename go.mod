@@ -2,15 +2,4 @@ module github.com/davidroman0O/comfylite3
 
 go 1.22.0
 
-require (
-	github.com/davidroman0O/retrypool v0.0.0-20241111214821-4cbfba842c21
-	github.com/mattn/go-sqlite3 v1.14.22
-)
-
-require (
-	github.com/petermattis/goid v0.0.0-20240813172612-4fcff4a6cae7 // indirect
-	github.com/sasha-s/go-deadlock v0.3.5 // indirect
-	go.uber.org/automaxprocs v1.6.0 // indirect
-	golang.org/x/sync v0.8.0 // indirect
-	golang.org/x/time v0.7.0 // indirect
-)
+require github.com/mattn/go-sqlite3 v1.14.22
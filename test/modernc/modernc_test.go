@@ -0,0 +1,90 @@
+package modernc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/davidroman0O/comfylite3"
+	_ "modernc.org/sqlite"
+)
+
+func TestModernc(t *testing.T) {
+	comfy, err := comfylite3.New(
+		comfylite3.WithPath(t.TempDir()+"/modernc.db"),
+		comfylite3.WithDriver("sqlite"),
+		comfylite3.WithReaders(2),
+		comfylite3.WithAutoVacuum("FULL"),
+		comfylite3.WithMigration(comfylite3.NewMigration(1, "pets", func(tx *sql.Tx) error {
+			_, err := tx.Exec("CREATE TABLE pets (id INTEGER PRIMARY KEY, name TEXT UNIQUE NOT NULL)")
+			return err
+		}, func(tx *sql.Tx) error {
+			_, err := tx.Exec("DROP TABLE pets")
+			return err
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfy.Close()
+	if err := comfy.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pragmas of the connection string, in the syntax of modernc.org/sqlite
+	var journalMode string
+	var busyTimeout, autoVacuum int
+	if err := comfy.QueryRow("SELECT * FROM pragma_journal_mode, pragma_busy_timeout, pragma_auto_vacuum").Scan(&journalMode, &busyTimeout, &autoVacuum); err != nil {
+		t.Fatal(err)
+	}
+	if journalMode != "wal" || busyTimeout != 5000 || autoVacuum != 1 {
+		t.Fatalf("expected wal, 5000 and 1, got %s, %d and %d", journalMode, busyTimeout, autoVacuum)
+	}
+
+	if _, err := comfy.Exec("INSERT INTO pets (name) VALUES (?)", "rex"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = comfy.Exec("INSERT INTO pets (name) VALUES (?)", "rex")
+	if !errors.Is(err, comfylite3.ErrConstraintUnique) {
+		t.Fatalf("expected ErrConstraintUnique, got %v", err)
+	}
+
+	db := comfylite3.OpenDB(comfy)
+	defer db.Close()
+	if _, err := db.Exec("INSERT INTO pets (name) VALUES ('felix')"); err != nil {
+		t.Fatal(err)
+	}
+	countID := comfy.NewRead(func(db *sql.DB) (interface{}, error) {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM pets").Scan(&count)
+		return count, err
+	})
+	if count, err := comfy.WaitFor(countID); err != nil || count != 2 {
+		t.Fatalf("expected 2 pets on the readers, got %v %v", count, err)
+	}
+
+	// what needs mattn/go-sqlite3
+	if err := comfy.RegisterFunc("double", func(n int) int { return n * 2 }, true); !errors.Is(err, comfylite3.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+	if err := comfy.Backup(t.TempDir() + "/backup.db"); !errors.Is(err, comfylite3.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+	if _, err := comfylite3.New(comfylite3.WithMemory(), comfylite3.WithDriver("sqlite"), comfylite3.WithBusyTimeout(0)); err == nil {
+		t.Fatal("expected the connect hooks to be refused")
+	}
+}
+
+func TestModerncMemory(t *testing.T) {
+	comfy, err := comfylite3.New(comfylite3.WithMemory(), comfylite3.WithDriver("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comfy.Close()
+
+	var n int
+	if err := comfy.QueryRow("SELECT 40 + 2").Scan(&n); err != nil || n != 42 {
+		t.Fatalf("expected 42, got %d %v", n, err)
+	}
+}